@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+)
+
+// problem is an issue with a sentinel error found by check.
+type problem struct {
+	pos token.Position
+	msg string
+}
+
+func (p problem) String() string {
+	return fmt.Sprintf("%s: %s", p.pos, p.msg)
+}
+
+// check reports sentinel errors with missing, malformed or duplicate codes in
+// the packages matching the patterns. It never modifies any files. It returns
+// false if any problems were found.
+func check(w io.Writer, dir string, patterns []string) (bool, error) {
+	files, err := loadGoFiles(token.NewFileSet(), dir, patterns)
+	if err != nil {
+		return false, err
+	}
+
+	c := newChecker()
+	for _, gf := range files {
+		c.checkFile(gf)
+	}
+
+	for _, p := range c.problems {
+		fmt.Fprintln(w, p)
+	}
+	return len(c.problems) == 0, nil
+}
+
+type checker struct {
+	codes    map[string]token.Position
+	problems []problem
+}
+
+func newChecker() *checker {
+	return &checker{codes: make(map[string]token.Position)}
+}
+
+func (c *checker) checkFile(gf *goFile) {
+	for _, sd := range findSentinels(gf.f) {
+		call := sd.call
+		pos := gf.position(call)
+		report := func(format string, args ...any) {
+			c.problems = append(c.problems, problem{pos, fmt.Sprintf(format, args...)})
+		}
+
+		if len(call.Args) != 2 {
+			report("Sentinel called with %d arguments, expected 2", len(call.Args))
+			continue
+		}
+
+		code, ok := codeOf(call)
+		switch {
+		case !ok:
+			report("code is not a string literal")
+		case code == "":
+			report("missing code")
+		case !checkCode(code):
+			report("malformed code %q", code)
+		default:
+			if first, ok := c.codes[code]; ok {
+				report("duplicate code %q, first used at %s", code, first)
+			} else {
+				c.codes[code] = pos
+			}
+		}
+	}
+}
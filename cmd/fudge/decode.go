@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"go/token"
+	"io"
+
+	"github.com/rossmacarthur/fudge/errors"
+	"github.com/rossmacarthur/fudge/internal/fudgepb"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// decode reads a serialized error from r and writes each hop to w in the %#v
+// style.
+// The input can be a google.rpc.Status or a fudge.Error in the binary, base64
+// or JSON protobuf encoding. If annotate is set then the sentinel codes in the
+// error are annotated with their declarations in the packages in the
+// directory.
+func decode(w io.Writer, r io.Reader, dir string, annotate bool) error {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	pb, s, err := unmarshalError(bs)
+	if err != nil {
+		return err
+	}
+	if pb == nil {
+		// NB: Not a Fudge error so there is only the status to show.
+		fmt.Fprintln(w, s.Err())
+		return nil
+	}
+
+	decoded := fudgepb.FromProto(pb)
+	var derr *fudgepb.DecodeError
+	if errors.As(decoded, &derr) {
+		fmt.Fprintf(w, "warning: %s\n", derr)
+		decoded = derr.Err
+	}
+	printHops(w, decoded)
+
+	if !annotate {
+		return nil
+	}
+
+	decls, err := sentinelDecls(dir)
+	if err != nil {
+		return err
+	}
+	for _, code := range codesOf(decoded) {
+		decl, ok := decls[code]
+		if !ok {
+			decl = "not found"
+		}
+		fmt.Fprintf(w, "%s: %s\n", code, decl)
+	}
+
+	return nil
+}
+
+// unmarshalError tries each supported encoding in turn. If the input is a
+// status without any Fudge error in the details then the status is returned.
+func unmarshalError(bs []byte) (*fudgepb.Error, *status.Status, error) {
+	// NB: Binary input can start or end with whitespace bytes so only the
+	// text encodings are trimmed.
+	text := bytes.TrimSpace(bs)
+
+	if bytes.HasPrefix(text, []byte("{")) {
+		var pb fudgepb.Error
+		if err := protojson.Unmarshal(text, &pb); err == nil {
+			return &pb, nil, nil
+		}
+		var sp spb.Status
+		if err := protojson.Unmarshal(text, &sp); err != nil {
+			return nil, nil, errors.Wrap(err, "invalid JSON")
+		}
+		epb, s := fromStatus(&sp)
+		return epb, s, nil
+	}
+
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if b, err := enc.DecodeString(string(text)); err == nil {
+			bs = b
+			break
+		}
+	}
+
+	// NB: Unmarshalling is lenient so the message with no unknown fields
+	// is the right one.
+	var sp spb.Status
+	if err := proto.Unmarshal(bs, &sp); err == nil && len(sp.ProtoReflect().GetUnknown()) == 0 {
+		if pb, s := fromStatus(&sp); pb != nil {
+			return pb, s, nil
+		}
+	}
+	var pb fudgepb.Error
+	if err := proto.Unmarshal(bs, &pb); err == nil && len(pb.ProtoReflect().GetUnknown()) == 0 && len(pb.Hops) > 0 {
+		return &pb, nil, nil
+	}
+	if len(sp.ProtoReflect().GetUnknown()) == 0 && (sp.Code != 0 || sp.Message != "") {
+		return nil, status.FromProto(&sp), nil
+	}
+
+	return nil, nil, errors.New("input is not a serialized status or Fudge error")
+}
+
+// fromStatus returns the Fudge error in the status details if there is one.
+func fromStatus(sp *spb.Status) (*fudgepb.Error, *status.Status) {
+	s := status.FromProto(sp)
+	for _, d := range s.Details() {
+		if pb, ok := d.(*fudgepb.Error); ok {
+			return pb, s
+		}
+	}
+	return nil, s
+}
+
+// printHops prints the full error message followed by each hop of the error,
+// i.e. each error in the chain, along with the binary it occurred in.
+func printHops(w io.Writer, err error) {
+	fmt.Fprintln(w, err)
+	for ; err != nil; err = errors.Unwrap(err) {
+		ferr, ok := err.(*errors.Error)
+		if !ok {
+			fmt.Fprintf(w, "\n%s\n", err)
+			continue
+		}
+		hop := *ferr
+		hop.Cause = nil
+		fmt.Fprintf(w, "\n[%s] %#v\n", hop.Binary, &hop)
+	}
+}
+
+// codesOf returns the unique sentinel codes in the error chain.
+func codesOf(err error) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	for ; err != nil; err = errors.Unwrap(err) {
+		ferr, ok := err.(*errors.Error)
+		if !ok || ferr.Code == "" || seen[ferr.Code] {
+			continue
+		}
+		seen[ferr.Code] = true
+		codes = append(codes, ferr.Code)
+	}
+	return codes
+}
+
+// sentinelDecls returns the declarations of all sentinel errors in the
+// packages in the directory by code.
+func sentinelDecls(dir string) (map[string]string, error) {
+	files, err := loadGoFiles(token.NewFileSet(), dir, []string{"./..."})
+	if err != nil {
+		return nil, err
+	}
+
+	decls := make(map[string]string)
+	for _, gf := range files {
+		for _, sd := range findSentinels(gf.f) {
+			code, ok := codeOf(sd.call)
+			if !ok || code == "" {
+				continue
+			}
+			pos := gf.position(sd.call)
+			decls[code] = fmt.Sprintf("%s.%s declared at %s:%d", gf.pkg, sd.name, pos.Filename, pos.Line)
+		}
+	}
+	return decls, nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rossmacarthur/fudge"
+	"github.com/rossmacarthur/fudge/errors"
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+)
+
+// spec is an error specification file.
+type spec struct {
+	// Package is the name of the generated package, if not set it is inferred
+	Package string      `yaml:"package" toml:"package"`
+	Errors  []specError `yaml:"errors" toml:"errors"`
+}
+
+// specError is a single sentinel error in an error specification file.
+type specError struct {
+	Name        string `yaml:"name" toml:"name"`
+	Message     string `yaml:"message" toml:"message"`
+	Code        string `yaml:"code" toml:"code"`
+	GRPC        string `yaml:"grpc" toml:"grpc"`
+	HTTP        int    `yaml:"http" toml:"http"`
+	Retryable   bool   `yaml:"retryable" toml:"retryable"`
+	Description string `yaml:"description" toml:"description"`
+}
+
+// gen generates a Go file with sentinel errors from the specification file.
+// If out is empty then the output file is named after the specification. If
+// check is set then nothing is written, instead any difference between the
+// specification and the output file is reported to w. It returns false if
+// there was a difference.
+func gen(w io.Writer, specPath, out string, check bool) (bool, error) {
+	if out == "" {
+		out = strings.TrimSuffix(specPath, filepath.Ext(specPath)) + "_gen.go"
+	}
+
+	s, err := loadSpec(specPath)
+	if err != nil {
+		return false, errors.Wrap(err, "", fudge.KV("path", specPath))
+	}
+
+	pkg, err := packageName(s, filepath.Dir(out))
+	if err != nil {
+		return false, err
+	}
+
+	src, err := generate(s, pkg, filepath.Base(specPath))
+	if err != nil {
+		return false, errors.Wrap(err, "", fudge.KV("path", specPath))
+	}
+
+	if check {
+		existing, err := os.ReadFile(out)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, errors.Wrap(err, "")
+		}
+		if !bytes.Equal(existing, src) {
+			fmt.Fprintf(w, "%s: out of date with %s, run fudge gen\n", out, specPath)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	if _, err := os.Stat(out); errors.Is(err, os.ErrNotExist) {
+		err = os.WriteFile(out, src, 0o644)
+		return true, errors.Wrap(err, "")
+	}
+	return true, writeFile(out, src)
+}
+
+// loadSpec reads the YAML or TOML specification file depending on the file
+// extension. Unknown fields are not allowed.
+func loadSpec(path string) (*spec, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	var s spec
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(bs))
+		dec.KnownFields(true)
+		err = dec.Decode(&s)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, errors.Wrap(err, "")
+		}
+	case ".toml":
+		md, err := toml.Decode(string(bs), &s)
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return nil, errors.New("unknown field", fudge.KV("field", keys[0]))
+		}
+	default:
+		return nil, errors.New("unknown spec format", fudge.KV("ext", ext))
+	}
+
+	return &s, s.validate()
+}
+
+var grpcCodes = func() map[string]codes.Code {
+	m := make(map[string]codes.Code)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		m[c.String()] = c
+	}
+	return m
+}()
+
+// grpcCode returns the gRPC code with the given name, either the Go name, e.g.
+// NotFound, or the canonical one, e.g. NOT_FOUND.
+func grpcCode(name string) (codes.Code, bool) {
+	if c, ok := grpcCodes[name]; ok {
+		return c, true
+	}
+	var c codes.Code
+	err := c.UnmarshalJSON([]byte(strconv.Quote(name)))
+	return c, err == nil
+}
+
+// reserved are the names that are declared or imported by the generated file.
+var reserved = map[string]bool{
+	"IsRetryable": true,
+	"errors":      true,
+	"codes":       true,
+	"gateway":     true,
+	"init":        true,
+	"_":           true,
+}
+
+// validate checks that every error has a valid name, message and code and
+// that the names, codes and statuses are valid. The gRPC codes are normalized
+// to their Go names.
+func (s *spec) validate() error {
+	if s.Package != "" && !token.IsIdentifier(s.Package) {
+		return errors.New("invalid package name", fudge.KV("package", s.Package))
+	}
+
+	names := make(map[string]bool)
+	used := make(map[string]bool)
+	for i := range s.Errors {
+		e := &s.Errors[i]
+		kv := fudge.KV("name", e.Name)
+		switch {
+		case !token.IsIdentifier(e.Name):
+			return errors.New("invalid name", kv)
+		case reserved[e.Name]:
+			return errors.New("reserved name", kv)
+		case names[e.Name]:
+			return errors.New("duplicate name", kv)
+		case e.Message == "":
+			return errors.New("missing message", kv)
+		case !checkCode(e.Code):
+			return errors.New("malformed code", kv, fudge.KV("code", e.Code))
+		case used[e.Code]:
+			return errors.New("duplicate code", kv, fudge.KV("code", e.Code))
+		}
+		if e.GRPC != "" {
+			c, ok := grpcCode(e.GRPC)
+			if !ok {
+				return errors.New("unknown gRPC code", kv, fudge.KV("grpc", e.GRPC))
+			}
+			if c == codes.OK {
+				// NB: Errors can't be returned with an OK status.
+				return errors.New("invalid gRPC code", kv, fudge.KV("grpc", e.GRPC))
+			}
+			e.GRPC = c.String()
+		}
+		if e.HTTP != 0 && http.StatusText(e.HTTP) == "" {
+			return errors.New("unknown HTTP status", kv, fudge.KV("http", e.HTTP))
+		}
+		names[e.Name] = true
+		used[e.Code] = true
+	}
+	return nil
+}
+
+// packageName returns the package name from the specification, otherwise the
+// package set by go generate or finally the name of the directory.
+func packageName(s *spec, dir string) (string, error) {
+	if s.Package != "" {
+		return s.Package, nil
+	}
+	if pkg := os.Getenv("GOPACKAGE"); pkg != "" {
+		return pkg, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrap(err, "")
+	}
+	pkg := filepath.Base(abs)
+	if !token.IsIdentifier(pkg) {
+		return "", errors.New("cannot infer package name", fudge.KV("dir", dir))
+	}
+	return pkg, nil
+}
+
+var genTemplate = template.Must(template.New("gen").Funcs(template.FuncMap{
+	"comment": comment,
+	"quote":   strconv.Quote,
+	"status":  http.StatusText,
+}).Parse(`// Code generated by fudge gen from {{ .Source }}. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"github.com/rossmacarthur/fudge/errors"
+{{- if .GRPC }}
+	"github.com/rossmacarthur/fudge/errors/codes"
+{{- end }}
+{{- if .HTTP }}
+	"github.com/rossmacarthur/fudge/errors/gateway"
+{{- end }}
+)
+
+var (
+{{- range $i, $e := .Errors }}
+{{- if $i }}
+{{ end }}
+{{- if .Description }}
+{{ comment .Description }}
+{{- end }}
+	{{ .Name }} = errors.Sentinel({{ quote .Message }}, {{ quote .Code }})
+{{- end }}
+)
+{{- if or .GRPC .HTTP }}
+
+func init() {
+{{- range .Errors }}
+{{- if .GRPC }}
+	codes.Register({{ .Name }}, codes.{{ .GRPC }})
+{{- end }}
+{{- if .HTTP }}
+	gateway.RegisterHTTPStatus({{ .Name }}, {{ .HTTP }}) // {{ status .HTTP }}
+{{- end }}
+{{- end }}
+}
+{{- end }}
+{{- if .Retryable }}
+
+// IsRetryable reports whether the error matches one of the retryable errors.
+func IsRetryable(err error) bool {
+	for _, target := range []error{
+{{- range .Retryable }}
+		{{ . }},
+{{- end }}
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+{{- end }}
+`))
+
+// generate returns the Go source for the specification.
+func generate(s *spec, pkg, source string) ([]byte, error) {
+	data := struct {
+		Source, Package string
+		Errors          []specError
+		GRPC, HTTP      bool
+		Retryable       []string
+	}{Source: source, Package: pkg, Errors: s.Errors}
+
+	for _, e := range s.Errors {
+		data.GRPC = data.GRPC || e.GRPC != ""
+		data.HTTP = data.HTTP || e.HTTP != 0
+		if e.Retryable {
+			data.Retryable = append(data.Retryable, e.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := genTemplate.Execute(&buf, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	return src, nil
+}
+
+// comment formats the text as an indented doc comment.
+func comment(text string) string {
+	var b strings.Builder
+	for i, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("\t//")
+		if line = strings.TrimRight(line, " \t"); line != "" {
+			b.WriteString(" " + line)
+		}
+	}
+	return b.String()
+}
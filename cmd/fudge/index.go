@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"go/token"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dave/dst"
+)
+
+// sentinel is a call to errors.Sentinel found in a file.
+type sentinel struct {
+	call *dst.CallExpr
+	pos  token.Position
+	code string
+	// pkg is the import path of the package the sentinel is declared in
+	pkg string
+	// name is the name of the variable the sentinel is assigned to
+	name string
+}
+
+// index is a module wide index of sentinel errors by code.
+type index struct {
+	sentinels []*sentinel
+	byCode    map[string][]*sentinel
+	// deterministic generates codes from the package path and variable name
+	// instead of randomly
+	deterministic bool
+}
+
+func newIndex(deterministic bool) *index {
+	return &index{
+		byCode:        make(map[string][]*sentinel),
+		deterministic: deterministic,
+	}
+}
+
+// addFile adds the sentinel errors in the file to the index. The position
+// function is used to find the position of each call and can be nil. The
+// package is the import path of the package the file belongs to.
+func (idx *index) addFile(f *dst.File, pkg string, position func(dst.Node) token.Position) {
+	for _, sd := range findSentinels(f) {
+		call := sd.call
+		s := &sentinel{call: call, pkg: pkg, name: sd.name}
+		if position != nil {
+			s.pos = position(call)
+		}
+		if code, ok := codeOf(call); ok && len(call.Args) == 2 && checkCode(code) {
+			s.code = code
+			idx.byCode[code] = append(idx.byCode[code], s)
+		}
+		idx.sentinels = append(idx.sentinels, s)
+	}
+}
+
+// ageFunc returns the time the line at the given position was written and
+// whether it is known.
+type ageFunc func(pos token.Position) (time.Time, bool)
+
+// change is a code that was rewritten by repair.
+type change struct {
+	pos      token.Position
+	from, to string
+	// keep is the position of the sentinel that kept the code if this was
+	// a duplicate
+	keep *token.Position
+}
+
+func (c change) String() string {
+	if c.keep != nil {
+		return fmt.Sprintf("%s: replaced duplicate code %s with %s, kept by %s", c.pos, c.from, c.to, *c.keep)
+	}
+	if c.from == "" {
+		return fmt.Sprintf("%s: added code %s", c.pos, c.to)
+	}
+	return fmt.Sprintf("%s: replaced invalid code %s with %s", c.pos, c.from, c.to)
+}
+
+// repair generates new codes for sentinel errors with invalid codes and for
+// all but the oldest sentinel error sharing a duplicate code. The age function
+// is used to find the oldest and can be nil. Sentinel errors with an unknown
+// age are considered newer than the others and ties are broken by position so
+// that the same one is always kept.
+func (idx *index) repair(age ageFunc) []change {
+	var changes []change
+
+	// Find the duplicates that need to be regenerated
+	duplicates := make(map[*sentinel]*sentinel)
+	for _, ss := range idx.byCode {
+		if len(ss) < 2 {
+			continue
+		}
+		type when struct {
+			t  time.Time
+			ok bool
+		}
+		ages := make(map[*sentinel]when, len(ss))
+		if age != nil {
+			for _, s := range ss {
+				t, ok := age(s.pos)
+				ages[s] = when{t, ok}
+			}
+		}
+		sort.SliceStable(ss, func(i, j int) bool {
+			a, b := ages[ss[i]], ages[ss[j]]
+			if a.ok != b.ok {
+				return a.ok
+			}
+			if a.ok && !a.t.Equal(b.t) {
+				return a.t.Before(b.t)
+			}
+			return positionLess(ss[i].pos, ss[j].pos)
+		})
+		for _, s := range ss[1:] {
+			duplicates[s] = ss[0]
+		}
+	}
+
+	for _, s := range idx.sentinels {
+		keep, dup := duplicates[s]
+		if s.code != "" && !dup {
+			continue
+		}
+
+		c := change{pos: s.pos, to: idx.newCode(s)}
+		if dup {
+			c.from = s.code
+			c.keep = &keep.pos
+		} else if code, ok := codeOf(s.call); ok {
+			c.from = code
+		}
+		changes = append(changes, c)
+
+		setCode(s.call, c.to)
+		s.code = c.to
+		idx.byCode[c.to] = []*sentinel{s}
+	}
+
+	return changes
+}
+
+// newCode returns a new code for the sentinel error that is not used by any
+// other sentinel error in the index. Codes are random unless the index is
+// deterministic.
+func (idx *index) newCode(s *sentinel) string {
+	for salt := 0; ; salt++ {
+		var code string
+		if idx.deterministic {
+			code = deterministicCode(s.pkg, s.name, salt)
+		} else {
+			code = randomCode()
+		}
+		if _, ok := idx.byCode[code]; !ok {
+			return code
+		}
+	}
+}
+
+// deterministicCode derives a code from a hash of the package path and
+// variable name. The salt is only added to the hash if it is non-zero and is
+// used to avoid collisions.
+func deterministicCode(pkg, name string, salt int) string {
+	key := pkg + "." + name
+	if salt > 0 {
+		key += "#" + strconv.Itoa(salt)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("ERR_%016x", binary.BigEndian.Uint64(sum[:8]))
+}
+
+// positionLess reports whether the position a comes before b.
+func positionLess(a, b token.Position) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// gitAge returns an age function that finds the time the line at the given
+// position was committed according to git blame. File names are relative to
+// the directory. The age of lines that are not committed or that can't be
+// blamed, e.g. because git is not installed, is unknown.
+func gitAge(dir string) ageFunc {
+	return func(pos token.Position) (time.Time, bool) {
+		return blameTime(dir, pos)
+	}
+}
+
+func blameTime(dir string, pos token.Position) (time.Time, bool) {
+	line := strconv.Itoa(pos.Line)
+	cmd := exec.Command("git", "blame", "--porcelain",
+		"-L", line+","+line, "--", pos.Filename)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, false
+	}
+	// NB: Uncommitted lines are blamed on a fake all zero commit with the
+	// current time.
+	if strings.HasPrefix(string(out), strings.Repeat("0", 40)) {
+		return time.Time{}, false
+	}
+	for _, l := range strings.Split(string(out), "\n") {
+		if t, ok := strings.CutPrefix(l, "committer-time "); ok {
+			sec, err := strconv.ParseInt(t, 10, 64)
+			if err != nil {
+				break
+			}
+			return time.Unix(sec, 0), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/rossmacarthur/fudge"
+	"github.com/rossmacarthur/fudge/errors"
+)
+
+// entry is a single sentinel error in the catalog output by list.
+type entry struct {
+	Package  string `json:"package"`
+	Name     string `json:"name"`
+	Message  string `json:"message"`
+	Code     string `json:"code"`
+	Doc      string `json:"doc"`
+	Position string `json:"position"`
+}
+
+// list writes a catalog of all sentinel errors in the packages matching the
+// patterns in the given format, one of "json", "csv" or "markdown".
+func list(w io.Writer, dir, format string, patterns []string) error {
+	var write func(io.Writer, []entry) error
+	switch format {
+	case "json":
+		write = writeJSON
+	case "csv":
+		write = writeCSV
+	case "markdown", "md":
+		write = writeMarkdown
+	default:
+		return errors.New("unknown format", fudge.KV("format", format))
+	}
+
+	files, err := loadGoFiles(token.NewFileSet(), dir, patterns)
+	if err != nil {
+		return err
+	}
+
+	var entries []entry
+	for _, gf := range files {
+		for _, sd := range findSentinels(gf.f) {
+			pos := gf.position(sd.call)
+			code, _ := codeOf(sd.call)
+			entries = append(entries, entry{
+				Package:  gf.pkg,
+				Name:     sd.name,
+				Message:  messageOf(sd.call),
+				Code:     code,
+				Doc:      sd.doc,
+				Position: fmt.Sprintf("%s:%d", pos.Filename, pos.Line),
+			})
+		}
+	}
+
+	return write(w, entries)
+}
+
+// messageOf returns the message argument of a call to errors.Sentinel if it is
+// a string literal.
+func messageOf(call *dst.CallExpr) string {
+	if len(call.Args) < 1 {
+		return ""
+	}
+	lit, ok := call.Args[0].(*dst.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+	msg, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return ""
+	}
+	return msg
+}
+
+func writeJSON(w io.Writer, entries []entry) error {
+	if entries == nil {
+		entries = []entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(entries), "")
+}
+
+func writeCSV(w io.Writer, entries []entry) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"package", "name", "message", "code", "doc", "position"})
+	for _, e := range entries {
+		_ = cw.Write([]string{e.Package, e.Name, e.Message, e.Code, e.Doc, e.Position})
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "")
+}
+
+func writeMarkdown(w io.Writer, entries []entry) error {
+	cell := func(s string) string {
+		s = strings.ReplaceAll(s, "|", `\|`)
+		return strings.ReplaceAll(s, "\n", " ")
+	}
+	code := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return "`" + s + "`"
+	}
+
+	fmt.Fprintln(w, "| Package | Name | Code | Message | Description | Position |")
+	fmt.Fprintln(w, "| ------- | ---- | ---- | ------- | ----------- | -------- |")
+	for _, e := range entries {
+		_, err := fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s |\n",
+			code(e.Package), code(e.Name), code(e.Code),
+			cell(e.Message), cell(e.Doc), e.Position)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/rossmacarthur/fudge"
+	"github.com/rossmacarthur/fudge/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// goFile is a parsed Go file belonging to a package.
+type goFile struct {
+	// path is the absolute path of the file
+	path string
+	// pkg is the import path of the package
+	pkg string
+	// src is the original contents of the file
+	src []byte
+
+	fset *token.FileSet
+	d    *decorator.Decorator
+	f    *dst.File
+}
+
+// position returns the position of the node in the file.
+func (gf *goFile) position(n dst.Node) token.Position {
+	return gf.fset.Position(gf.d.Ast.Nodes[n].Pos())
+}
+
+// defaultPatterns returns the package patterns used if none are given. When
+// run using go generate only the current package is processed.
+func defaultPatterns() []string {
+	if os.Getenv("GOFILE") != "" {
+		return []string{"."}
+	}
+	return []string{"./..."}
+}
+
+// loadGoFiles loads the packages matching the patterns relative to the
+// directory and parses their Go files, including test files. Only files
+// matching the current build constraints are included. Files in vendor
+// directories and generated files are skipped.
+//
+// File names are relative to the directory so that positions are readable.
+func loadGoFiles(fset *token.FileSet, dir string, patterns []string) ([]*goFile, error) {
+	if len(patterns) == 0 {
+		patterns = defaultPatterns()
+	}
+
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles | packages.NeedModule,
+		Dir:   dir,
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load packages")
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	// NB: Vendor directories are looked for relative to the main module so
+	// that a module checked out below a directory named vendor still works.
+	root := absDir
+	for _, pkg := range pkgs {
+		if pkg.Module != nil && pkg.Module.Main {
+			root = pkg.Module.Dir
+			break
+		}
+	}
+
+	var files []*goFile
+	seen := make(map[string]bool)
+
+	for _, pkg := range pkgs {
+		// NB: Packages with missing dependencies still have files, only fail
+		// if the package couldn't be found at all.
+		if len(pkg.GoFiles) == 0 && len(pkg.Errors) > 0 {
+			return nil, errors.New(pkg.Errors[0].Msg, fudge.KV("package", pkg.ID))
+		}
+		for _, path := range pkg.GoFiles {
+			// NB: Test variants of packages contain the same files
+			if seen[path] || isVendored(root, path) {
+				continue
+			}
+			seen[path] = true
+
+			gf, err := parseGoFile(fset, absDir, pkg.PkgPath, path)
+			if err != nil {
+				return nil, errors.Wrap(err, "", fudge.KV("path", path))
+			}
+			if gf != nil {
+				files = append(files, gf)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// parseGoFile reads and parses the file. It returns nil if the file is
+// generated.
+func parseGoFile(fset *token.FileSet, dir, pkg, path string) (*goFile, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	if isGenerated(src) {
+		return nil, nil
+	}
+
+	name := path
+	if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		name = rel
+	}
+
+	d := decorator.NewDecorator(fset)
+	f, err := d.ParseFile(name, src, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	return &goFile{path: path, pkg: pkg, src: src, fset: fset, d: d, f: f}, nil
+}
+
+// isVendored reports whether the file is in a vendor directory below the
+// root directory.
+func isVendored(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		if elem == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
+var generated = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the source has a generated code comment before
+// the package clause.
+func isGenerated(src []byte) bool {
+	s := bufio.NewScanner(bytes.NewReader(src))
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+		if generated.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFile atomically writes the contents to the file by writing to a
+// temporary file in the same directory and renaming it. The permissions of
+// the existing file are kept.
+func writeFile(path string, contents []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(contents)
+	if err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "")
+	}
+	err = tmp.Chmod(info.Mode().Perm())
+	if err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "")
+	}
+	err = tmp.Close()
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), path), "")
+}
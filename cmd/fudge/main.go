@@ -1,14 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"flag"
 	"fmt"
 	"go/token"
+	"io"
 	"math"
 	"math/big"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/dave/dst"
 	"github.com/dave/dst/decorator"
@@ -24,127 +27,331 @@ A tool for managing sentinel error codes
 for github.com/rossmacarthur/fudge errors.
 
 Usage:
-    fudge [OPTIONS]
+    fudge [OPTIONS] [PACKAGES]
+    fudge check [PACKAGES]
+    fudge list [-format FORMAT] [PACKAGES]
+    fudge migrate [PACKAGES]
+    fudge gen [-check] [-o FILE] SPEC
+    fudge decode [-annotate]
+
+Packages are given as patterns, e.g. ./... (the default). When
+run by go generate only the current package is processed.
+
+When sentinel errors share a duplicate code the one on the line
+committed first according to git blame keeps it. Lines that are
+uncommitted or can't be blamed, e.g. when git is not installed,
+count as newest and otherwise the first in file order keeps it.
+
+Commands:
+    check    Report sentinel errors with invalid or duplicate codes
+             without modifying any files
+    list     Output a catalog of all sentinel errors
+    migrate  Rewrite fmt.Errorf and github.com/pkg/errors calls to use
+             Fudge errors, reporting any that need to be migrated by hand
+    gen      Generate sentinel errors from a YAML or TOML specification
+    decode   Print a serialized error read from stdin, either a
+             google.rpc.Status or a fudge.Error encoded as binary,
+             base64 or JSON protobuf
 
 Options:
-    -h, --help     Print help
+    -deterministic   Derive new codes from a hash of the package path and
+                     variable name instead of generating them randomly
+    -format FORMAT   The list output format: json, csv or markdown (default: json)
+    -annotate        Annotate sentinel codes with their declarations in
+                     the current module
+    -check           Report if the generated file is out of date with the
+                     specification instead of writing it
+    -o FILE          The generated file (default: SPEC_gen.go)
+    -h, --help       Print help
 `
 
 func main() {
 	flag.Usage = func() {
 		fmt.Fprint(flag.CommandLine.Output(), usage)
 	}
+	deterministic := flag.Bool("deterministic", false, "")
 	flag.Parse()
 
-	fset := token.NewFileSet()
-
-	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	var err error
+	switch cmd := flag.Arg(0); cmd {
+	case "check":
+		var ok bool
+		ok, err = check(os.Stderr, ".", flag.Args()[1:])
+		if err == nil && !ok {
+			os.Exit(1)
 		}
-		if info.IsDir() {
-			return nil
+	case "list":
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		fs.Usage = flag.Usage
+		format := fs.String("format", "json", "")
+		_ = fs.Parse(flag.Args()[1:])
+		err = list(os.Stdout, ".", *format, fs.Args())
+	case "migrate":
+		var ok bool
+		ok, err = migrate(os.Stderr, ".", flag.Args()[1:])
+		if err == nil && !ok {
+			os.Exit(1)
 		}
-		if filepath.Ext(path) != ".go" {
-			return nil
+	case "gen":
+		fs := flag.NewFlagSet("gen", flag.ExitOnError)
+		fs.Usage = flag.Usage
+		check := fs.Bool("check", false, "")
+		out := fs.String("o", "", "")
+		_ = fs.Parse(flag.Args()[1:])
+		if fs.NArg() != 1 {
+			err = errors.New("expected a single specification file")
+			break
 		}
-		err = rewriteSentinelErrors(fset, path)
-		if err != nil {
-			return errors.Wrap(err, "", fudge.KV("path", path))
+		var ok bool
+		ok, err = gen(os.Stderr, fs.Arg(0), *out, *check)
+		if err == nil && !ok {
+			os.Exit(1)
 		}
-		return nil
-	})
+	case "decode":
+		fs := flag.NewFlagSet("decode", flag.ExitOnError)
+		fs.Usage = flag.Usage
+		annotate := fs.Bool("annotate", false, "")
+		_ = fs.Parse(flag.Args()[1:])
+		err = decode(os.Stdout, os.Stdin, ".", *annotate)
+	default:
+		err = rewrite(os.Stdout, ".", flag.Args(), gitAge("."), *deterministic)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %#v\n", err)
 		os.Exit(1)
 	}
 }
 
-func rewriteSentinelErrors(fset *token.FileSet, path string) error {
-	// Parse the file
-	f, err := decorator.ParseFile(fset, path, nil, 0)
+// rewrite rewrites the sentinel errors in the packages matching the patterns
+// to have valid and unique codes. Every change is reported to w and only the
+// files that changed are written. If deterministic is set then new codes are
+// derived from the package path and variable name.
+func rewrite(w io.Writer, dir string, patterns []string, age ageFunc, deterministic bool) error {
+	files, err := loadGoFiles(token.NewFileSet(), dir, patterns)
 	if err != nil {
-		return errors.Wrap(err, "")
+		return err
 	}
 
-	// Find and rewrite the sentinel errors
-	rewriteSentinelErrorsInFile(f)
+	idx := newIndex(deterministic)
+	for _, gf := range files {
+		idx.addFile(gf.f, gf.pkg, gf.position)
+	}
 
-	// Write the file back
-	of, err := os.Create(path)
-	if err != nil {
-		return errors.Wrap(err, "")
+	// Rewrite the invalid and duplicate codes
+	for _, c := range idx.repair(age) {
+		fmt.Fprintln(w, c)
 	}
-	defer of.Close()
 
-	err = decorator.Fprint(of, f)
-	if err != nil {
-		return errors.Wrap(err, "")
+	// Write back the files that changed
+	for _, gf := range files {
+		var buf bytes.Buffer
+		err := decorator.Fprint(&buf, gf.f)
+		if err != nil {
+			return errors.Wrap(err, "", fudge.KV("path", gf.path))
+		}
+		if bytes.Equal(buf.Bytes(), gf.src) {
+			continue
+		}
+		err = writeFile(gf.path, buf.Bytes())
+		if err != nil {
+			return errors.Wrap(err, "", fudge.KV("path", gf.path))
+		}
 	}
 
-	return err
+	return nil
 }
 
+// rewriteSentinelErrorsInFile rewrites the sentinel errors in a single file to
+// have valid and unique codes.
 func rewriteSentinelErrorsInFile(f *dst.File) {
-	var alias string
-
-	dst.Inspect(f, func(n dst.Node) bool {
-		if spec, ok := n.(*dst.ImportSpec); ok {
-			if spec.Path.Value == `"`+imp+`"` {
-				if spec.Name != nil {
-					alias = spec.Name.Name
-				} else {
-					alias = filepath.Base(imp)
-				}
+	idx := newIndex(false)
+	idx.addFile(f, "", nil)
+	idx.repair(nil)
+}
+
+// setCode sets the code argument of a call to errors.Sentinel, adding or
+// removing arguments as necessary.
+func setCode(call *dst.CallExpr, code string) {
+	var args []dst.Expr
+	if len(call.Args) > 0 {
+		args = append(args, call.Args[0])
+	} else {
+		args = append(args, &dst.BasicLit{
+			Kind:  token.STRING,
+			Value: `""`,
+		})
+	}
+	call.Args = append(args, &dst.BasicLit{
+		Kind:  token.STRING,
+		Value: strconv.Quote(code),
+	})
+}
+
+// sentinelDecl is a variable declared or assigned using a call to
+// errors.Sentinel.
+type sentinelDecl struct {
+	// call is the call to errors.Sentinel
+	call *dst.CallExpr
+	// name is the name of the variable (can be empty)
+	name string
+	// doc is the doc comment of the variable (can be empty)
+	doc string
+}
+
+// findSentinels returns all variables that are declared using a call to
+// errors.Sentinel, including multi-name declarations and assignments in init
+// functions. The errors package can be imported using any name including a
+// dot import.
+func findSentinels(f *dst.File) []sentinelDecl {
+	finder := sentinelFinder{name: importNames(f)[imp]}
+	if finder.name == "" || finder.name == "_" {
+		return nil
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *dst.GenDecl:
+			finder.genDecl(d)
+		case *dst.FuncDecl:
+			if d.Body == nil {
+				continue
 			}
+			init := d.Name.Name == "init" && d.Recv == nil
+			dst.Inspect(d.Body, func(n dst.Node) bool {
+				switch n := n.(type) {
+				case *dst.DeclStmt:
+					if gd, ok := n.Decl.(*dst.GenDecl); ok {
+						finder.genDecl(gd)
+					}
+				case *dst.AssignStmt:
+					if init {
+						finder.assignStmt(n)
+					}
+				}
+				return true
+			})
 		}
+	}
 
-		if spec, ok := n.(*dst.ValueSpec); ok {
-			// Check if the value is a call to errors.Sentinel
-			if len(spec.Values) != 1 {
-				return false
-			}
-			call, ok := spec.Values[0].(*dst.CallExpr)
-			if !ok {
-				return false
-			}
-			sel, ok := call.Fun.(*dst.SelectorExpr)
+	return finder.sentinels
+}
+
+type sentinelFinder struct {
+	// name is the name the errors package is imported as
+	name      string
+	sentinels []sentinelDecl
+}
+
+// isSentinel returns the call if the expression is a call to errors.Sentinel.
+func (sf *sentinelFinder) isSentinel(e dst.Expr) (*dst.CallExpr, bool) {
+	call, ok := e.(*dst.CallExpr)
+	if !ok {
+		return nil, false
+	}
+	switch fun := call.Fun.(type) {
+	case *dst.Ident:
+		return call, sf.name == "." && fun.Name == "Sentinel"
+	case *dst.SelectorExpr:
+		x, ok := fun.X.(*dst.Ident)
+		return call, ok && x.Name == sf.name && fun.Sel.Name == "Sentinel"
+	}
+	return nil, false
+}
+
+func (sf *sentinelFinder) genDecl(d *dst.GenDecl) {
+	if d.Tok != token.VAR {
+		return
+	}
+	for _, spec := range d.Specs {
+		spec, ok := spec.(*dst.ValueSpec)
+		if !ok {
+			continue
+		}
+
+		// The doc comment is attached to the declaration unless the
+		// variable is declared in a block
+		doc := spec.Decs.Start
+		if len(doc) == 0 && len(d.Specs) == 1 {
+			doc = d.Decs.Start
+		}
+
+		for i, v := range spec.Values {
+			call, ok := sf.isSentinel(v)
 			if !ok {
-				return false
-			}
-			if sel.Sel.Name != "Sentinel" {
-				return false
+				continue
 			}
-			if sel.X.(*dst.Ident).Name != alias {
-				return false
+			var name string
+			if len(spec.Names) == len(spec.Values) {
+				name = spec.Names[i].Name
 			}
+			sf.sentinels = append(sf.sentinels, sentinelDecl{
+				call: call,
+				name: name,
+				doc:  docText(doc),
+			})
+		}
+	}
+}
 
-			if len(call.Args) == 2 {
-				if lit, ok := call.Args[1].(*dst.BasicLit); ok && lit.Kind == token.STRING {
-					if checkCode(lit.Value[1 : len(lit.Value)-1]) {
-						return false
-					}
-				}
+func (sf *sentinelFinder) assignStmt(s *dst.AssignStmt) {
+	for i, rhs := range s.Rhs {
+		call, ok := sf.isSentinel(rhs)
+		if !ok {
+			continue
+		}
+		var name string
+		if len(s.Lhs) == len(s.Rhs) {
+			switch lhs := s.Lhs[i].(type) {
+			case *dst.Ident:
+				name = lhs.Name
+			case *dst.SelectorExpr:
+				name = lhs.Sel.Name
 			}
+		}
+		sf.sentinels = append(sf.sentinels, sentinelDecl{
+			call: call,
+			name: name,
+			doc:  docText(s.Decs.Start),
+		})
+	}
+}
 
-			var args []dst.Expr
-			if len(call.Args) > 0 {
-				args = append(args, call.Args[0])
-			} else {
-				args = append(args, &dst.BasicLit{
-					Kind:  token.STRING,
-					Value: `""`,
-				})
+// docText returns the text of a doc comment without the comment markers.
+func docText(decs dst.Decorations) string {
+	var lines []string
+	for _, d := range decs {
+		switch {
+		case strings.HasPrefix(d, "//"):
+			lines = append(lines, strings.TrimSpace(strings.TrimPrefix(d, "//")))
+		case strings.HasPrefix(d, "/*"):
+			d = strings.TrimSuffix(strings.TrimPrefix(d, "/*"), "*/")
+			for _, l := range strings.Split(d, "\n") {
+				lines = append(lines, strings.TrimSpace(l))
 			}
-			call.Args = append(args, &dst.BasicLit{
-				Kind:  token.STRING,
-				Value: `"` + randomCode() + `"`,
-			})
-
+		default:
+			// NB: Empty lines separate comment groups, only the last group
+			// directly above the declaration is the doc comment.
+			lines = nil
 		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
 
-		return true
-	})
+// codeOf returns the code argument of a call to errors.Sentinel if it is a
+// string literal.
+func codeOf(call *dst.CallExpr) (string, bool) {
+	if len(call.Args) < 2 {
+		return "", false
+	}
+	lit, ok := call.Args[1].(*dst.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	code, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", false
+	}
+	return code, true
 }
 
 var randReader = rand.Reader
@@ -165,7 +372,7 @@ func checkCode(code string) bool {
 		return false
 	}
 	for _, c := range code[4:] {
-		if c < '0' || c > 'f' {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
 			return false
 		}
 	}
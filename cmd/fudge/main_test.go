@@ -2,23 +2,34 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"go/format"
+	"go/parser"
 	"go/token"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/dave/dst"
 	"github.com/dave/dst/decorator"
+	"github.com/rossmacarthur/fudge/internal/fudgepb"
 	"github.com/sebdah/goldie/v2"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func Test_rewriteSentinelErrors(t *testing.T) {
 	r := randReader
 	t.Cleanup(func() { randReader = r })
-	randReader = rand.New(rand.NewSource(1))
 
 	_, file, _, _ := runtime.Caller(0)
 	dir := filepath.Join(filepath.Dir(file), "testdata")
@@ -39,6 +50,10 @@ func Test_rewriteSentinelErrors(t *testing.T) {
 		name := strings.TrimSuffix(filename, ".go")
 
 		t.Run(name, func(t *testing.T) {
+			// NB: Seed for each file so the codes don't depend on the
+			// other files.
+			randReader = rand.New(rand.NewSource(1))
+
 			in := filepath.Join(dir, filename)
 
 			f, err := decorator.ParseFile(fset, in, nil, 0)
@@ -54,3 +69,431 @@ func Test_rewriteSentinelErrors(t *testing.T) {
 		})
 	}
 }
+
+func Test_check(t *testing.T) {
+	var buf bytes.Buffer
+	ok, err := check(&buf, ".", []string{"./testdata/check"})
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	g := goldie.New(t)
+	g.Assert(t, "check", buf.Bytes())
+}
+
+func Test_rewrite(t *testing.T) {
+	r := randReader
+	t.Cleanup(func() { randReader = r })
+	randReader = rand.New(rand.NewSource(1))
+
+	root, entries := copyTestdata(t, "duplicates")
+
+	// b.go is older than a.go
+	age := func(pos token.Position) (time.Time, bool) {
+		t := time.Unix(int64(pos.Line), 0)
+		if filepath.Base(pos.Filename) == "a.go" {
+			t = t.Add(time.Hour)
+		}
+		return t, true
+	}
+
+	var buf bytes.Buffer
+	err := rewrite(&buf, root, nil, age, false)
+	require.Nil(t, err)
+
+	g := goldie.New(t)
+	g.Assert(t, "duplicates", buf.Bytes())
+
+	for _, entry := range entries {
+		bs, err := os.ReadFile(filepath.Join(root, entry.Name()))
+		require.Nil(t, err)
+		g.Assert(t, filepath.Join("duplicates", strings.TrimSuffix(entry.Name(), ".go")), bs)
+	}
+}
+
+func Test_list(t *testing.T) {
+	g := goldie.New(t)
+
+	for _, format := range []string{"json", "csv", "markdown"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := list(&buf, ".", format, []string{"./testdata/list"})
+			require.Nil(t, err)
+			g.Assert(t, filepath.Join("list", format), buf.Bytes())
+		})
+	}
+}
+
+func Test_rewriteDeterministic(t *testing.T) {
+	root, entries := copyTestdata(t, "duplicates")
+
+	var buf bytes.Buffer
+	err := rewrite(&buf, root, nil, nil, true)
+	require.Nil(t, err)
+	require.Contains(t, buf.String(), deterministicCode("example.com/test", "ErrMissing", 0))
+
+	before := readFiles(t, root, entries)
+
+	// rewriting again is idempotent
+	buf.Reset()
+	err = rewrite(&buf, root, nil, nil, true)
+	require.Nil(t, err)
+	require.Empty(t, buf.String())
+	require.Equal(t, before, readFiles(t, root, entries))
+}
+
+func Test_rewriteUnknownAge(t *testing.T) {
+	root, _ := copyTestdata(t, "duplicates")
+
+	// only the age of b.go is known so it is kept even though a.go comes first
+	age := func(pos token.Position) (time.Time, bool) {
+		return time.Unix(0, 0), filepath.Base(pos.Filename) == "b.go"
+	}
+
+	var buf bytes.Buffer
+	err := rewrite(&buf, root, nil, age, true)
+	require.Nil(t, err)
+	require.Contains(t, buf.String(), "a.go:6:17: replaced duplicate code ERR_52fdfc072182654f")
+
+	// without any ages the first position is kept
+	root, _ = copyTestdata(t, "duplicates")
+	age = func(token.Position) (time.Time, bool) {
+		return time.Time{}, false
+	}
+
+	buf.Reset()
+	err = rewrite(&buf, root, nil, age, true)
+	require.Nil(t, err)
+	require.Contains(t, buf.String(), "b.go:5:19: replaced duplicate code ERR_52fdfc072182654f")
+	require.Contains(t, buf.String(), "b.go:9:21: replaced duplicate code ERR_163f5f0f9a621d72")
+}
+
+func Test_loadGoFiles(t *testing.T) {
+	files, err := loadGoFiles(token.NewFileSet(), ".", []string{"./testdata/load"})
+	require.Nil(t, err)
+
+	var names []string
+	for _, gf := range files {
+		require.Equal(t, "github.com/rossmacarthur/fudge/cmd/fudge/testdata/load", gf.pkg)
+		names = append(names, gf.position(gf.f).Filename)
+	}
+	require.Equal(t, []string{
+		filepath.Join("testdata", "load", "a.go"),
+		filepath.Join("testdata", "load", "a_test.go"),
+	}, names)
+
+	root := filepath.Join("src", "vendor", "example.com", "mod")
+	require.True(t, isVendored(root, filepath.Join(root, "vendor", "example.com", "dep", "dep.go")))
+	require.False(t, isVendored(root, filepath.Join(root, "internal", "vendored", "dep.go")))
+	require.False(t, isVendored(root, filepath.Join(root, "a.go")))
+}
+
+func Test_loadGoFilesBelowVendor(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "vendor", "example.com", "mod")
+	require.Nil(t, os.MkdirAll(dir, 0o755))
+	err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/mod\n"), 0o644)
+	require.Nil(t, err)
+	err = os.WriteFile(filepath.Join(dir, "a.go"), []byte("package mod\n"), 0o644)
+	require.Nil(t, err)
+
+	files, err := loadGoFiles(token.NewFileSet(), dir, nil)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "example.com/mod", files[0].pkg)
+}
+
+func Test_rewriteUnchanged(t *testing.T) {
+	root, entries := copyTestdata(t, "duplicates")
+	a := filepath.Join(root, entries[0].Name())
+	err := os.Chmod(a, 0o600)
+	require.Nil(t, err)
+
+	err = rewrite(io.Discard, root, nil, nil, true)
+	require.Nil(t, err)
+
+	info, err := os.Stat(a)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// files without changes are not written
+	old := time.Unix(0, 0)
+	err = os.Chtimes(a, old, old)
+	require.Nil(t, err)
+
+	err = rewrite(io.Discard, root, nil, nil, true)
+	require.Nil(t, err)
+
+	info, err = os.Stat(a)
+	require.Nil(t, err)
+	require.True(t, info.ModTime().Equal(old))
+}
+
+func Test_migrateFile(t *testing.T) {
+	dir := filepath.Join("testdata", "migrate")
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+
+	g := goldie.New(t)
+
+	for _, entry := range entries {
+		filename := entry.Name()
+		if !strings.HasSuffix(filename, ".go") {
+			continue
+		}
+
+		name := strings.TrimSuffix(filename, ".go")
+
+		t.Run(name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			d := decorator.NewDecorator(fset)
+			f, err := d.ParseFile(filepath.Join(dir, filename), nil, parser.ParseComments)
+			require.Nil(t, err)
+
+			problems := migrateFile(f, func(n dst.Node) token.Position {
+				return fset.Position(d.Ast.Nodes[n].Pos())
+			})
+
+			var buf bytes.Buffer
+			err = decorator.Fprint(&buf, f)
+			require.Nil(t, err)
+			src, err := format.Source(buf.Bytes())
+			require.Nil(t, err)
+
+			// The problems are appended as comments
+			for _, p := range problems {
+				src = append(src, "// "+p.String()+"\n"...)
+			}
+
+			g.Assert(t, filepath.Join("migrate", name), src)
+		})
+	}
+}
+
+func Test_gen(t *testing.T) {
+	g := goldie.New(t)
+
+	for _, ext := range []string{"yaml", "toml"} {
+		t.Run(ext, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "errors_gen.go")
+			spec := filepath.Join("testdata", "gen", "errors."+ext)
+
+			// check fails if the file doesn't exist yet
+			var buf bytes.Buffer
+			ok, err := gen(&buf, spec, out, true)
+			require.Nil(t, err)
+			require.False(t, ok)
+			require.Contains(t, buf.String(), "out of date")
+
+			ok, err = gen(io.Discard, spec, out, false)
+			require.Nil(t, err)
+			require.True(t, ok)
+
+			bs, err := os.ReadFile(out)
+			require.Nil(t, err)
+			// NB: The source file name is the only difference
+			bs = bytes.Replace(bs, []byte("errors."+ext), []byte("errors.spec"), 1)
+			g.Assert(t, filepath.Join("gen", "errors"), bs)
+
+			ok, err = gen(io.Discard, spec, out, true)
+			require.Nil(t, err)
+			require.True(t, ok)
+		})
+	}
+}
+
+func Test_loadSpecInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		exp  string
+	}{
+		{
+			name: "unknown field",
+			spec: "errors:\n  - name: ErrTest\n    status: 404\n",
+			exp:  "field status not found",
+		},
+		{
+			name: "invalid name",
+			spec: "errors:\n  - name: Err Test\n",
+			exp:  "invalid name",
+		},
+		{
+			name: "reserved name",
+			spec: "errors:\n  - {name: IsRetryable, message: such test, code: ERR_0a8cba3dfa944ecb}\n",
+			exp:  "reserved name",
+		},
+		{
+			name: "missing message",
+			spec: "errors:\n  - name: ErrTest\n",
+			exp:  "missing message",
+		},
+		{
+			name: "malformed code",
+			spec: "errors:\n  - name: ErrTest\n    message: such test\n    code: 1234\n",
+			exp:  "malformed code",
+		},
+		{
+			name: "duplicate code",
+			spec: "errors:\n" +
+				"  - {name: ErrA, message: such a, code: ERR_0a8cba3dfa944ecb}\n" +
+				"  - {name: ErrB, message: such b, code: ERR_0a8cba3dfa944ecb}\n",
+			exp: "duplicate code",
+		},
+		{
+			name: "unknown gRPC code",
+			spec: "errors:\n  - {name: ErrTest, message: such test, code: ERR_0a8cba3dfa944ecb, grpc: NOT_A_CODE}\n",
+			exp:  "unknown gRPC code",
+		},
+		{
+			name: "OK gRPC code",
+			spec: "errors:\n  - {name: ErrTest, message: such test, code: ERR_0a8cba3dfa944ecb, grpc: OK}\n",
+			exp:  "invalid gRPC code",
+		},
+		{
+			name: "unknown HTTP status",
+			spec: "errors:\n  - {name: ErrTest, message: such test, code: ERR_0a8cba3dfa944ecb, http: 999}\n",
+			exp:  "unknown HTTP status",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "errors.yaml")
+			err := os.WriteFile(path, []byte(tc.spec), 0o644)
+			require.Nil(t, err)
+
+			_, err = loadSpec(path)
+			require.ErrorContains(t, err, tc.exp)
+		})
+	}
+}
+
+func Test_decode(t *testing.T) {
+	pb := &fudgepb.Error{
+		Hops: []*fudgepb.Hop{
+			{
+				Kind:    fudgepb.Kind_KIND_FUDGE,
+				Binary:  "shop",
+				Message: "rpc error",
+				Trace: []*fudgepb.Frame{
+					{File: "shop/main.go", Function: "main", Line: 12},
+				},
+			},
+			{
+				Kind:    fudgepb.Kind_KIND_FUDGE,
+				Binary:  "barber",
+				Message: "razor not found",
+				Code:    "ERR_0a8cba3dfa944ecb",
+				Method:  "/barber.Barber/Shave",
+				Time:    timestamppb.New(time.Date(2023, 5, 22, 13, 37, 0, 0, time.UTC)),
+				Trace: []*fudgepb.Frame{
+					{
+						File:      "barber/shave.go",
+						Function:  "shave",
+						Line:      42,
+						Message:   "failed to shave",
+						KeyValues: []*fudgepb.KeyValue{{Key: "yak", Value: "bob"}},
+					},
+				},
+			},
+		},
+	}
+
+	raw, err := proto.Marshal(pb)
+	require.Nil(t, err)
+	st, err := status.New(codes.NotFound, "razor not found").WithDetails(pb)
+	require.Nil(t, err)
+	bin, err := proto.Marshal(st.Proto())
+	require.Nil(t, err)
+	rawJSON, err := protojson.Marshal(pb)
+	require.Nil(t, err)
+	binJSON, err := protojson.Marshal(st.Proto())
+	require.Nil(t, err)
+
+	inputs := map[string][]byte{
+		"status binary": bin,
+		"status base64": []byte(base64.StdEncoding.EncodeToString(bin) + "\n"),
+		"status json":   binJSON,
+		"raw binary":    raw,
+		"raw base64":    []byte(base64.RawStdEncoding.EncodeToString(raw)),
+		"raw json":      rawJSON,
+	}
+
+	g := goldie.New(t)
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := decode(&buf, bytes.NewReader(input), ".", false)
+			require.Nil(t, err)
+			g.Assert(t, "decode", buf.Bytes())
+		})
+	}
+
+	t.Run("annotate", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := decode(&buf, bytes.NewReader(raw), filepath.Join("testdata", "list"), true)
+		require.Nil(t, err)
+		require.True(t, strings.HasSuffix(buf.String(), "ERR_0a8cba3dfa944ecb: "+
+			"github.com/rossmacarthur/fudge/cmd/fudge/testdata/list.ErrRazorNotFound declared at errors.go:6\n"))
+	})
+
+	t.Run("status without details", func(t *testing.T) {
+		bin, err := proto.Marshal(status.New(codes.NotFound, "razor not found").Proto())
+		require.Nil(t, err)
+
+		var buf bytes.Buffer
+		err = decode(&buf, bytes.NewReader(bin), ".", false)
+		require.Nil(t, err)
+		require.Equal(t, "rpc error: code = NotFound desc = razor not found\n", buf.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := decode(io.Discard, strings.NewReader("such garbage"), ".", false)
+		require.NotNil(t, err)
+	})
+}
+
+func Test_deterministicCode(t *testing.T) {
+	code := deterministicCode("example.com/test", "ErrTest", 0)
+	require.True(t, checkCode(code))
+	require.Equal(t, code, deterministicCode("example.com/test", "ErrTest", 0))
+	require.NotEqual(t, code, deterministicCode("example.com/test", "ErrTest", 1))
+	require.NotEqual(t, code, deterministicCode("example.com/other", "ErrTest", 0))
+	require.NotEqual(t, code, deterministicCode("example.com/test", "ErrOther", 0))
+}
+
+// copyTestdata copies the Go files in the testdata directory to a temporary
+// module.
+func copyTestdata(t *testing.T, name string) (string, []os.DirEntry) {
+	src := filepath.Join("testdata", name)
+	root := t.TempDir()
+
+	var entries []os.DirEntry
+	all, err := os.ReadDir(src)
+	require.Nil(t, err)
+	for _, entry := range all {
+		if !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		entries = append(entries, entry)
+		bs, err := os.ReadFile(filepath.Join(src, entry.Name()))
+		require.Nil(t, err)
+		err = os.WriteFile(filepath.Join(root, entry.Name()), bs, 0o644)
+		require.Nil(t, err)
+	}
+
+	err = os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/test\n"), 0o644)
+	require.Nil(t, err)
+
+	return root, entries
+}
+
+func readFiles(t *testing.T, root string, entries []os.DirEntry) map[string]string {
+	files := make(map[string]string)
+	for _, entry := range entries {
+		bs, err := os.ReadFile(filepath.Join(root, entry.Name()))
+		require.Nil(t, err)
+		files[entry.Name()] = string(bs)
+	}
+	return files
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/rossmacarthur/fudge"
+	"github.com/rossmacarthur/fudge/errors"
+	"github.com/rossmacarthur/fudge/internal/verbs"
+)
+
+const (
+	fudgeImp     = "github.com/rossmacarthur/fudge"
+	pkgErrorsImp = "github.com/pkg/errors"
+)
+
+// migrate rewrites calls to fmt.Errorf and github.com/pkg/errors in the
+// packages matching the patterns to use Fudge errors. Calls that can't be
+// migrated automatically are reported to w and left unchanged. It returns
+// false if anything was reported.
+func migrate(w io.Writer, dir string, patterns []string) (bool, error) {
+	files, err := loadGoFiles(token.NewFileSet(), dir, patterns)
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+	for _, gf := range files {
+		for _, p := range migrateFile(gf.f, gf.position) {
+			fmt.Fprintln(w, p)
+			ok = false
+		}
+
+		var buf bytes.Buffer
+		err := decorator.Fprint(&buf, gf.f)
+		if err != nil {
+			return false, errors.Wrap(err, "", fudge.KV("path", gf.path))
+		}
+		if bytes.Equal(buf.Bytes(), gf.src) {
+			continue
+		}
+		// NB: Formatting sorts any imports that were added.
+		src, err := format.Source(buf.Bytes())
+		if err != nil {
+			return false, errors.Wrap(err, "", fudge.KV("path", gf.path))
+		}
+		err = writeFile(gf.path, src)
+		if err != nil {
+			return false, errors.Wrap(err, "", fudge.KV("path", gf.path))
+		}
+	}
+
+	return ok, nil
+}
+
+// migrateFile rewrites calls to fmt.Errorf and github.com/pkg/errors in the
+// file to use Fudge errors and fixes the imports. The problems with calls that
+// can't be migrated are returned. The position function is used to find the
+// position of each call and can be nil.
+func migrateFile(f *dst.File, position func(dst.Node) token.Position) []problem {
+	m := &migrator{f: f, position: position, imports: importNames(f)}
+	m.run()
+	return m.problems
+}
+
+// migrator migrates a single file.
+type migrator struct {
+	f        *dst.File
+	position func(dst.Node) token.Position
+	problems []problem
+
+	// imports maps the import paths in the file to their names
+	imports map[string]string
+	// errors and fudge are the names Fudge packages are referred to by
+	errors, fudge string
+	// usesFudge is set if any rewritten call uses fudge.KV
+	usesFudge bool
+	// global are the calls evaluated during package initialization
+	global map[*dst.CallExpr]bool
+}
+
+// callRewrite is a pending rewrite of a call.
+type callRewrite struct {
+	call  *dst.CallExpr
+	apply func()
+}
+
+func (m *migrator) report(n dst.Node, format string, args ...any) {
+	var pos token.Position
+	if m.position != nil {
+		pos = m.position(n)
+	}
+	m.problems = append(m.problems, problem{pos, fmt.Sprintf(format, args...)})
+}
+
+func (m *migrator) run() {
+	m.errors = m.imports[imp]
+	m.fudge = m.imports[fudgeImp]
+	if m.errors == "" {
+		m.errors = "errors"
+	}
+	if m.fudge == "" {
+		m.fudge = "fudge"
+	}
+
+	fmtName := m.imports["fmt"]
+	stdName := m.imports["errors"]
+	pkgName := m.imports[pkgErrorsImp]
+	m.global = globalCalls(m.f)
+
+	calls := make(map[string][]*dst.CallExpr)
+	uses := make(map[string][]string)
+	dst.Inspect(m.f, func(n dst.Node) bool {
+		switch n := n.(type) {
+		case *dst.SelectorExpr:
+			if x, ok := n.X.(*dst.Ident); ok {
+				uses[x.Name] = append(uses[x.Name], n.Sel.Name)
+			}
+		case *dst.CallExpr:
+			if sel, ok := n.Fun.(*dst.SelectorExpr); ok {
+				if x, ok := sel.X.(*dst.Ident); ok {
+					calls[x.Name] = append(calls[x.Name], n)
+				}
+			}
+		}
+		return true
+	})
+
+	var rewrites []callRewrite
+
+	// Calls to fmt.Errorf
+	if fmtName != "" {
+		for _, call := range calls[fmtName] {
+			if call.Fun.(*dst.SelectorExpr).Sel.Name != "Errorf" {
+				continue
+			}
+			apply, reason := m.fromFormat(call, call.Args, nil)
+			if reason != "" {
+				m.report(call, "cannot migrate fmt.Errorf: %s", reason)
+				continue
+			}
+			rewrites = append(rewrites, callRewrite{call, apply})
+		}
+	}
+
+	// Calls to github.com/pkg/errors, these are all or nothing since the
+	// import can only be removed if every call is migrated
+	var removes []string
+	if pkgName != "" {
+		var pkgRewrites []callRewrite
+		ok := true
+		for _, call := range calls[pkgName] {
+			fn := call.Fun.(*dst.SelectorExpr).Sel.Name
+			apply, reason := m.fromPkgErrors(call, fn)
+			if reason != "" {
+				m.report(call, "cannot migrate %s.%s: %s", pkgName, fn, reason)
+				ok = false
+				continue
+			}
+			pkgRewrites = append(pkgRewrites, callRewrite{call, apply})
+		}
+		if len(uses[pkgName]) != len(calls[pkgName]) {
+			m.report(m.f.Name, "cannot migrate %s: functions are used without being called", pkgErrorsImp)
+			ok = false
+		}
+		if ok {
+			rewrites = append(rewrites, pkgRewrites...)
+			removes = append(removes, pkgErrorsImp)
+		} else if pkgName == m.errors {
+			m.report(m.f.Name, "cannot migrate file: %s is imported as %s", pkgErrorsImp, pkgName)
+			return
+		}
+	}
+
+	if len(rewrites) == 0 {
+		return
+	}
+
+	// The standard library errors package is replaced if it is in the way
+	if stdName == m.errors && m.imports[imp] == "" {
+		for _, fn := range uses[stdName] {
+			switch fn {
+			case "New", "Is", "As", "Unwrap":
+			default:
+				m.report(m.f.Name, "cannot migrate file: errors.%s has no Fudge equivalent", fn)
+				return
+			}
+		}
+		removes = append(removes, "errors")
+	}
+
+	for _, r := range rewrites {
+		r.apply()
+	}
+
+	// Fix the imports
+	var adds []string
+	if m.imports[imp] == "" {
+		adds = append(adds, imp)
+	}
+	if m.usesFudge && m.imports[fudgeImp] == "" {
+		adds = append(adds, fudgeImp)
+	}
+	if fmtName != "" && !usesPackage(m.f, fmtName) {
+		removes = append(removes, "fmt")
+	}
+	fixImports(m.f, removes, adds)
+}
+
+// fromPkgErrors returns a function that rewrites a call to a function in
+// github.com/pkg/errors. If the call can't be migrated then the reason is
+// returned instead.
+func (m *migrator) fromPkgErrors(call *dst.CallExpr, fn string) (func(), string) {
+	retarget := func(name string) func() {
+		return func() {
+			call.Fun = m.errorsFunc(name)
+		}
+	}
+
+	switch fn {
+	case "New", "Is", "As", "Unwrap":
+		return retarget(fn), ""
+	case "Wrap", "WithMessage":
+		return retarget("Wrap"), ""
+	case "WithStack":
+		if len(call.Args) != 1 {
+			return nil, "wrong number of arguments"
+		}
+		return func() {
+			call.Fun = m.errorsFunc("Wrap")
+			call.Args = append(call.Args, stringLit(""))
+		}, ""
+	case "Errorf":
+		return m.fromFormat(call, call.Args, nil)
+	case "Wrapf", "WithMessagef":
+		if len(call.Args) < 2 {
+			return nil, "wrong number of arguments"
+		}
+		return m.fromFormat(call, call.Args[1:], call.Args[0])
+	default:
+		return nil, "no Fudge equivalent"
+	}
+}
+
+// fromFormat returns a function that rewrites a call with a format and
+// arguments to create a Fudge error. The arguments are converted to key values
+// and the cause is the argument to a %w verb at the end of the format, unless
+// one is given. If the call can't be migrated then the reason is returned
+// instead.
+func (m *migrator) fromFormat(call *dst.CallExpr, args []dst.Expr, cause dst.Expr) (func(), string) {
+	if call.Ellipsis {
+		return nil, "arguments are passed using ..."
+	}
+	if len(args) == 0 {
+		return nil, "missing format"
+	}
+	lit, ok := args[0].(*dst.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return nil, "format is not a string literal"
+	}
+	format, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return nil, "format is not a string literal"
+	}
+	vs, ok := verbs.Parse(format)
+	if !ok {
+		return nil, "format uses argument indexes or star widths"
+	}
+	if len(vs) != len(args)-1 {
+		return nil, "wrong number of arguments for format"
+	}
+
+	var kvs []dst.Expr
+	keys := make(map[string]bool)
+	for i, v := range vs {
+		arg := args[i+1]
+
+		if v.Verb == 'w' {
+			if cause != nil || i != len(vs)-1 || v.End != len(format) {
+				return nil, "%w is not used once at the end of the format"
+			}
+			cause = arg
+			continue
+		}
+
+		key, ok := keyOf(arg)
+		if !ok {
+			return nil, fmt.Sprintf("no name for argument %d", i+1)
+		}
+		if isErrorName(key) {
+			return nil, fmt.Sprintf("%s is formatted without %%w", key)
+		}
+		if keys[key] {
+			return nil, fmt.Sprintf("duplicate name %s for arguments", key)
+		}
+		keys[key] = true
+		kvs = append(kvs, arg)
+	}
+	msg := verbs.Message(format, vs)
+
+	// NB: errors.New panics if it is called with options at package scope.
+	if cause == nil && len(kvs) > 0 && m.global[call] {
+		return nil, "arguments can't be converted to key values at package scope"
+	}
+
+	return func() {
+		var newArgs []dst.Expr
+		if cause != nil {
+			call.Fun = m.errorsFunc("Wrap")
+			newArgs = append(newArgs, cause)
+		} else {
+			call.Fun = m.errorsFunc("New")
+		}
+		newArgs = append(newArgs, stringLit(msg))
+		for _, arg := range kvs {
+			key, _ := keyOf(arg)
+			newArgs = append(newArgs, &dst.CallExpr{
+				Fun:  &dst.SelectorExpr{X: dst.NewIdent(m.fudge), Sel: dst.NewIdent("KV")},
+				Args: []dst.Expr{stringLit(key), arg},
+			})
+			m.usesFudge = true
+		}
+		call.Args = newArgs
+	}, ""
+}
+
+// globalCalls returns the calls in the file that are evaluated during package
+// initialization, i.e. those in package level declarations outside of
+// function literals.
+func globalCalls(f *dst.File) map[*dst.CallExpr]bool {
+	global := make(map[*dst.CallExpr]bool)
+	for _, d := range f.Decls {
+		gd, ok := d.(*dst.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			continue
+		}
+		dst.Inspect(gd, func(n dst.Node) bool {
+			switch n := n.(type) {
+			case *dst.FuncLit:
+				return false
+			case *dst.CallExpr:
+				global[n] = true
+			}
+			return true
+		})
+	}
+	return global
+}
+
+func (m *migrator) errorsFunc(name string) dst.Expr {
+	return &dst.SelectorExpr{X: dst.NewIdent(m.errors), Sel: dst.NewIdent(name)}
+}
+
+// keyOf returns the key name for a format argument based on the expression.
+func keyOf(e dst.Expr) (string, bool) {
+	switch e := e.(type) {
+	case *dst.Ident:
+		return e.Name, true
+	case *dst.SelectorExpr:
+		return e.Sel.Name, true
+	case *dst.CallExpr:
+		if len(e.Args) == 0 {
+			return keyOf(e.Fun)
+		}
+	case *dst.IndexExpr:
+		return keyOf(e.X)
+	case *dst.StarExpr:
+		return keyOf(e.X)
+	case *dst.UnaryExpr:
+		return keyOf(e.X)
+	case *dst.ParenExpr:
+		return keyOf(e.X)
+	}
+	return "", false
+}
+
+// isErrorName reports whether the name looks like it refers to an error, these
+// should be wrapped instead of converted to key values.
+func isErrorName(name string) bool {
+	name = strings.ToLower(name)
+	return name == "err" || strings.HasSuffix(name, "err") || strings.HasSuffix(name, "error")
+}
+
+func stringLit(s string) *dst.BasicLit {
+	return &dst.BasicLit{Kind: token.STRING, Value: strconv.Quote(s)}
+}
+
+// importNames returns the names of the packages imported by the file by
+// import path. Packages are assumed to be named after the last element of
+// their import path.
+func importNames(f *dst.File) map[string]string {
+	names := make(map[string]string)
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil {
+			names[p] = spec.Name.Name
+		} else {
+			names[p] = path.Base(p)
+		}
+	}
+	return names
+}
+
+// usesPackage reports whether the package name is referred to in the file.
+func usesPackage(f *dst.File, name string) bool {
+	var found bool
+	dst.Inspect(f, func(n dst.Node) bool {
+		if sel, ok := n.(*dst.SelectorExpr); ok {
+			if x, ok := sel.X.(*dst.Ident); ok && x.Name == name {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// fixImports removes and adds imports in the file. New imports are added to
+// the last import group unless it only contains standard library packages.
+func fixImports(f *dst.File, removes, adds []string) {
+	remove := make(map[string]bool)
+	for _, p := range removes {
+		remove[strconv.Quote(p)] = true
+	}
+
+	var decl *dst.GenDecl
+	var decls []dst.Decl
+	for _, d := range f.Decls {
+		gd, ok := d.(*dst.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			decls = append(decls, d)
+			continue
+		}
+		var specs []dst.Spec
+		for _, s := range gd.Specs {
+			if !remove[s.(*dst.ImportSpec).Path.Value] {
+				specs = append(specs, s)
+			}
+		}
+		gd.Specs = specs
+		if len(specs) == 0 && (decl != nil || len(adds) == 0) {
+			continue
+		}
+		if decl == nil {
+			decl = gd
+		}
+		decls = append(decls, gd)
+	}
+
+	if len(adds) > 0 {
+		if decl == nil {
+			decl = &dst.GenDecl{Tok: token.IMPORT}
+			decls = append([]dst.Decl{decl}, decls...)
+		}
+
+		group := false
+		for _, s := range decl.Specs {
+			if s.Decorations().Before == dst.EmptyLine {
+				group = false
+			}
+			if strings.Contains(strings.SplitN(s.(*dst.ImportSpec).Path.Value, "/", 2)[0], ".") {
+				group = true
+			}
+		}
+		for i, p := range adds {
+			spec := &dst.ImportSpec{Path: stringLit(p)}
+			if i == 0 && !group && len(decl.Specs) > 0 {
+				spec.Decs.Before = dst.EmptyLine
+			}
+			decl.Specs = append(decl.Specs, spec)
+		}
+	}
+
+	if decl != nil {
+		decl.Lparen = len(decl.Specs) > 1
+	}
+
+	f.Decls = decls
+	f.Imports = nil
+	for _, d := range decls {
+		if gd, ok := d.(*dst.GenDecl); ok && gd.Tok == token.IMPORT {
+			for _, s := range gd.Specs {
+				f.Imports = append(f.Imports, s.(*dst.ImportSpec))
+			}
+		}
+	}
+}
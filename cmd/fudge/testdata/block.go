@@ -0,0 +1,13 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+var (
+	// ErrA is the first error.
+	ErrA = errors.Sentinel("a error", "")
+
+	// ErrB is the second error.
+	ErrB = errors.Sentinel("b error", "ERR_d2b7d8b2f9e4c1a0")
+
+	errOther = errors.New("other error")
+)
@@ -0,0 +1,13 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+var ErrValid = errors.Sentinel("valid", "ERR_52fdfc072182654f")
+
+var ErrMissing = errors.Sentinel("missing", "")
+
+var ErrMalformed = errors.Sentinel("malformed", "ERR_12345")
+
+var ErrOneArg = errors.Sentinel("one arg")
+
+var ErrMoreArgs = errors.Sentinel("more args", "ERR_163f5f0f9a621d72", "test")
@@ -0,0 +1,11 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+var ErrDuplicate = errors.Sentinel("duplicate", "ERR_52fdfc072182654f")
+
+var ErrNotLiteral = errors.Sentinel("not literal", code)
+
+const code = "ERR_7bbb0407d1e2c649"
+
+var ErrUppercase = errors.Sentinel("uppercase", "ERR_7BBB0407D1E2C649")
@@ -0,0 +1,8 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+// ErrCopied was copy-pasted from b.go
+var ErrCopied = errors.Sentinel("copied", "ERR_52fdfc072182654f")
+
+var ErrMissing = errors.Sentinel("missing", "")
@@ -0,0 +1,9 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+var ErrOriginal = errors.Sentinel("original", "ERR_52fdfc072182654f")
+
+var ErrUnique = errors.Sentinel("unique", "ERR_163f5f0f9a621d72")
+
+var ErrAlsoCopied = errors.Sentinel("also copied", "ERR_163f5f0f9a621d72")
@@ -0,0 +1,11 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+var ErrA, ErrB error
+
+func init() {
+	// ErrA is assigned in init.
+	ErrA = errors.Sentinel("a error", "")
+	ErrB = errors.Sentinel("b error", "")
+}
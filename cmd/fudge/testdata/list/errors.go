@@ -0,0 +1,18 @@
+package list
+
+import "github.com/rossmacarthur/fudge/errors"
+
+// ErrRazorNotFound is returned when there is no razor to shave the yak with.
+var ErrRazorNotFound = errors.Sentinel("razor not found", "ERR_0a8cba3dfa944ecb")
+
+var (
+	// ErrYakEscaped is returned when the yak ran away, this is a
+	// "retryable" error | try again later.
+	ErrYakEscaped = errors.Sentinel("yak escaped", "ERR_52fdfc072182654f")
+
+	ErrNoCode = errors.Sentinel("no code", "")
+)
+
+// Not a doc comment
+
+var ErrUndocumented = errors.Sentinel("undocumented", "ERR_163f5f0f9a621d72")
@@ -0,0 +1,5 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+var errTest = errors.Sentinel("such test", "")
@@ -0,0 +1,7 @@
+//go:build ignore
+
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+var ErrIgnored = errors.Sentinel("such ignored", "")
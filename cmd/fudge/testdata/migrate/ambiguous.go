@@ -0,0 +1,36 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func join(err1, err2 error) error {
+	return errors.Join(err1, err2)
+}
+
+func middle(err error) error {
+	return fmt.Errorf("failed: %w: try again", err)
+}
+
+func verb(err error) error {
+	return fmt.Errorf("failed: %v", err)
+}
+
+func unnamed(a, b int) error {
+	return fmt.Errorf("failed: %d", a+b)
+}
+
+func dynamic(format string) error {
+	return fmt.Errorf(format)
+}
+
+func cause(err error) error {
+	return pkgerrors.Cause(err)
+}
+
+func wrap(err error) error {
+	return fmt.Errorf("failed: %w", err)
+}
@@ -0,0 +1,30 @@
+package test
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func wrap(err error) error {
+	return fmt.Errorf("failed to shave yak: %w", err)
+}
+
+func wrapArgs(err error, user User, id int) error {
+	return fmt.Errorf("failed to shave yak %d for %s: %w", id, user.Name, err)
+}
+
+func wrapOnly(err error) error {
+	return fmt.Errorf("%w", err)
+}
+
+func newArgs(id int) error {
+	return fmt.Errorf("yak %d not found", id)
+}
+
+func format(id int) string {
+	return fmt.Sprintf("yak %d", id) + strconv.Itoa(id)
+}
+
+type User struct {
+	Name string
+}
@@ -0,0 +1,21 @@
+package test
+
+import (
+	"fmt"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+var name = "yak"
+
+var ErrPlain = fmt.Errorf("yak not found")
+
+var ErrArgs = fmt.Errorf("bad %s", name)
+
+var ErrPkgArgs = pkgerrors.Errorf("bad %s", name)
+
+var ErrWrapped = fmt.Errorf("failed to shave %s: %w", name, ErrPlain)
+
+var lazy = func() error {
+	return fmt.Errorf("bad %s", name)
+}
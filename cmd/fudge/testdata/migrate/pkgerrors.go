@@ -0,0 +1,21 @@
+package test
+
+import (
+	"github.com/pkg/errors"
+)
+
+var ErrNotFound = errors.New("not found")
+
+func find(id int) error {
+	err := lookup(id)
+	if errors.Is(err, ErrNotFound) {
+		return errors.WithStack(err)
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to find yak %d", id)
+	}
+	return errors.Wrap(lookup(id+1), "failed to find next yak")
+}
+
+func lookup(id int) error {
+	return errors.Errorf("no yak %d", id)
+}
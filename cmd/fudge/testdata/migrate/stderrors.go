@@ -0,0 +1,17 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrNotFound = errors.New("not found")
+
+func read(r io.Reader) error {
+	_, err := r.Read(nil)
+	if errors.Is(err, io.EOF) {
+		return ErrNotFound
+	}
+	return fmt.Errorf("read failed: %w", err)
+}
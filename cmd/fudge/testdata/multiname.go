@@ -0,0 +1,5 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+var ErrA, ErrB = errors.Sentinel("a error", ""), errors.Sentinel("b error", "")
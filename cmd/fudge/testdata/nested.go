@@ -0,0 +1,15 @@
+package test
+
+import "github.com/rossmacarthur/fudge/errors"
+
+type sentinels struct {
+	errors struct {
+		Sentinel func(msg, code string) error
+	}
+}
+
+var s sentinels
+
+var ErrNested = s.errors.Sentinel("nested error", "")
+
+var ErrTest = errors.Sentinel("test error", "")
@@ -0,0 +1,15 @@
+// Command fudgevet reports misuse of github.com/rossmacarthur/fudge errors.
+//
+// It can be run directly or as a vet tool.
+//
+//	go vet -vettool=$(which fudgevet) ./...
+package main
+
+import (
+	"github.com/rossmacarthur/fudge/fudgevet"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(fudgevet.Analyzer)
+}
@@ -0,0 +1,78 @@
+// Package codes maps sentinel errors to the status codes returned by the
+// server interceptors. The codes are transport neutral, they have the same
+// values as the gRPC and Connect codes so the registry is shared by the
+// errors/grpc and errors/connect packages.
+package codes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rossmacarthur/fudge/errors"
+)
+
+// Code is a status code, it has the same value as the gRPC and Connect code
+// with the same name.
+type Code uint32
+
+const (
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	AlreadyExists      Code = 6
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	DataLoss           Code = 15
+	Unauthenticated    Code = 16
+)
+
+// registry is the table of sentinel errors mapped to codes, in registration
+// order.
+var registry struct {
+	sync.RWMutex
+	list []sentinelCode
+}
+
+type sentinelCode struct {
+	sentinel error
+	code     Code
+}
+
+// Register registers the code that should be used by the server interceptors
+// when an error matches the given sentinel error using Is.
+//
+// This function is intended to be called from an init function. Sentinels are
+// checked in registration order.
+func Register(sentinel error, code Code) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.list = append(registry.list, sentinelCode{sentinel, code})
+}
+
+// Of returns the registered code for the error. Context errors have their own
+// codes and any other error is unknown.
+func Of(err error) Code {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, c := range registry.list {
+		if errors.Is(err, c.sentinel) {
+			return c.code
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		return DeadlineExceeded
+	}
+	return Unknown
+}
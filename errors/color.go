@@ -0,0 +1,125 @@
+package errors
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// palette is the set of ANSI SGR parameters used to paint each part of an
+// error. An empty parameter means the part is not painted.
+type palette struct {
+	message  string
+	code     string
+	key      string
+	hop      string
+	metadata string
+	function string
+	library  string
+	caret    string
+	wrap     string
+}
+
+// colors is the palette used by the ColorFormatter
+var colors = palette{
+	message:  "1;31", // bold red
+	code:     "33",   // yellow
+	key:      "36",   // cyan
+	hop:      "1;35", // bold magenta
+	metadata: "2",    // faint
+	function: "1",    // bold
+	library:  "2",    // faint
+	caret:    "1;31", // bold red
+	wrap:     "3",    // italic
+}
+
+// paint wraps the text in the ANSI escape sequence for the SGR parameter
+func (p palette) paint(sgr, text string) string {
+	if sgr == "" {
+		return text
+	}
+	return "\x1b[" + sgr + "m" + text + "\x1b[0m"
+}
+
+// keyValues returns the key values in insertion order with each key painted
+func (p palette) keyValues(kvs KeyValues) string {
+	var s strings.Builder
+	for i, g := range kvs.groups() {
+		if i > 0 {
+			s.WriteString(", ")
+		}
+		s.WriteString(p.paint(p.key, g.key))
+		s.WriteString(":")
+		s.WriteString(g.value())
+	}
+	return s.String()
+}
+
+// ColorFormatter is a Formatter that prints the same layout as the
+// MultilineFormatter using ANSI colours. Messages, codes, key values and hop
+// boundaries are highlighted and frames outside of the module are dimmed.
+//
+// It is intended for developer tools and local sessions, use
+// NewTerminalFormatter to only enable colour when writing to a terminal.
+type ColorFormatter struct {
+	// Module is the module path of the frames that are not dimmed, if empty
+	// then the main module is used
+	Module string
+	// Source is the number of lines of source code to print before and after
+	// each frame, see SourceFormatter (can be zero)
+	Source int
+	// Trace prints the message and key values of each frame under the frame,
+	// see TraceFormatter
+	Trace bool
+}
+
+// FormatError implements the Formatter interface
+func (c *ColorFormatter) FormatError(s fmt.State, _ rune, e *Error) {
+	module := c.Module
+	if module == "" {
+		module = mainModule()
+	}
+	own := func(f Frame) bool {
+		if module == "" {
+			return false
+		}
+		// NB: The file name depends on the FilePathStyle so prefer the package.
+		if f.Package != "" {
+			return f.Package == "main" || f.Package == module || strings.HasPrefix(f.Package, module+"/")
+		}
+		return strings.HasPrefix(f.File, module+"/")
+	}
+	hopLayout{p: colors, own: own, source: c.Source, frames: c.Trace}.format(s, e)
+}
+
+// mainModule returns the path of the main module if it is known
+var mainModule = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return info.Main.Path
+})
+
+// NewTerminalFormatter returns a ColorFormatter if the file is a terminal and
+// colour has not been disabled, otherwise it returns the MultilineFormatter.
+//
+// Colour is disabled if the NO_COLOR environment variable is set to any
+// non-empty value (see https://no-color.org) or if TERM is "dumb". For example:
+//
+//	errors.SetFormatter(errors.NewTerminalFormatter(os.Stderr))
+func NewTerminalFormatter(f *os.File) Formatter {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" || !isTerminal(f) {
+		return MultilineFormatter
+	}
+	return &ColorFormatter{}
+}
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	return f != nil && term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,71 @@
+package connect
+
+import (
+	"context"
+	"io"
+
+	"connectrpc.com/connect"
+)
+
+// NewInterceptor returns a Connect interceptor that returns Fudge error
+// information in the Connect error details on the handler side and converts
+// Connect error details into Fudge errors on the client side.
+func NewInterceptor() connect.Interceptor {
+	return &interceptor{}
+}
+
+type interceptor struct{}
+
+// WrapUnary implements the connect.Interceptor interface
+func (i *interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		resp, err := next(ctx, req)
+		if req.Spec().IsClient {
+			return resp, interceptClient(err)
+		}
+		return resp, interceptServer(req.Spec(), req.Peer(), err)
+	}
+}
+
+// WrapStreamingClient implements the connect.Interceptor interface
+func (i *interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		return &clientConn{StreamingClientConn: next(ctx, spec)}
+	}
+}
+
+// WrapStreamingHandler implements the connect.Interceptor interface
+func (i *interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		return interceptServer(conn.Spec(), conn.Peer(), next(ctx, conn))
+	}
+}
+
+type clientConn struct {
+	connect.StreamingClientConn
+}
+
+func (c *clientConn) Send(m any) error {
+	return interceptStream(c.StreamingClientConn.Send(m))
+}
+
+func (c *clientConn) Receive(m any) error {
+	return interceptStream(c.StreamingClientConn.Receive(m))
+}
+
+func (c *clientConn) CloseRequest() error {
+	return interceptStream(c.StreamingClientConn.CloseRequest())
+}
+
+func (c *clientConn) CloseResponse() error {
+	return interceptStream(c.StreamingClientConn.CloseResponse())
+}
+
+// interceptStream is like interceptClient but io.EOF, which marks the normal
+// end of a stream, is returned unchanged since callers compare against it.
+func interceptStream(err error) error {
+	if err == io.EOF {
+		return err
+	}
+	return interceptClient(err)
+}
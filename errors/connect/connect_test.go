@@ -0,0 +1,331 @@
+package connect_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/rossmacarthur/fudge/errors"
+	"github.com/rossmacarthur/fudge/errors/codes"
+	errorsconnect "github.com/rossmacarthur/fudge/errors/connect"
+	"github.com/rossmacarthur/fudge/internal/connecttest"
+	"github.com/stretchr/testify/require"
+)
+
+var errSentinel = errors.Sentinel("such test", "ERR_12345")
+
+var errNotFound = errors.Sentinel("such missing", "ERR_67890")
+
+func init() {
+	codes.Register(errNotFound, codes.NotFound)
+}
+
+func TestInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+
+		// noServerIntercept doesn't add the server Connect interceptor
+		noServerIntercept bool
+
+		// noClientIntercept doesn't add the client Connect interceptor
+		noClientIntercept bool
+
+		// errFn generates the error on the server
+		errFn func() error
+
+		// expFn asserts any conditions this test case requires
+		expFn func(t *testing.T, client *connecttest.Client)
+	}{
+		{
+			name:              "unary: no interceptor: nil",
+			noServerIntercept: true,
+			noClientIntercept: true,
+			errFn: func() error {
+				return nil
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.Nil(t, err)
+			},
+		},
+		{
+			name:              "unary: no interceptor: context canceled",
+			noServerIntercept: true,
+			noClientIntercept: true,
+			errFn: func() error {
+				return context.Canceled
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.False(t, isFudge(err))
+				require.False(t, errors.Is(err, context.Canceled))
+				require.Equal(t, connect.CodeCanceled, connect.CodeOf(err))
+			},
+		},
+		{
+			name:              "unary: no interceptor: fudge error",
+			noServerIntercept: true,
+			noClientIntercept: true,
+			errFn: func() error {
+				return errors.New("such test")
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.False(t, isFudge(err))
+				require.Equal(t, "unknown: such test", err.Error())
+			},
+		},
+		{
+			name: "unary: with interceptor: nil",
+			errFn: func() error {
+				return nil
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.Nil(t, err)
+			},
+		},
+		{
+			name: "unary: with interceptor: context canceled",
+			errFn: func() error {
+				return context.Canceled
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.True(t, isFudge(err))
+				require.ErrorIs(t, err, context.Canceled)
+				require.Equal(t, "rpc error: context canceled", err.Error())
+			},
+		},
+		{
+			name: "unary: with interceptor: context deadline exceeded",
+			errFn: func() error {
+				return context.DeadlineExceeded
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.True(t, isFudge(err))
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				require.Equal(t, "rpc error: context deadline exceeded", err.Error())
+			},
+		},
+		{
+			name: "unary: with interceptor: fudge error",
+			errFn: func() error {
+				return errors.New("such test")
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.True(t, isFudge(err))
+				require.Equal(t, "rpc error: such test", err.Error())
+			},
+		},
+		{
+			name: "unary: with interceptor: fudge sentinel error",
+			errFn: func() error {
+				return errors.Wrap(errSentinel, "")
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.ErrorIs(t, err, errSentinel)
+				require.Equal(t, "rpc error: such test (ERR_12345)", err.Error())
+			},
+		},
+		{
+			name: "unary: with interceptor: extra hop",
+			errFn: func() error {
+				return errors.New("such test")
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 1)
+				require.Equal(t, "rpc error: rpc error: such test", err.Error())
+			},
+		},
+		{
+			name: "unary: with interceptor: hop metadata",
+			errFn: func() error {
+				return errors.New("such test")
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 1)
+				require.Nil(t, err.(*errors.Error).Metadata)
+
+				for i := 0; i < 2; i++ {
+					err = err.(*errors.Error).Cause
+					md := err.(*errors.Error).Metadata
+					require.Equal(t, "/candystore.CandyStore/Buy", md.Method)
+					require.NotEmpty(t, md.Peer)
+					require.False(t, md.Time.IsZero())
+				}
+			},
+		},
+		{
+			name:              "unary: with interceptor: registered code",
+			noClientIntercept: true,
+			errFn: func() error {
+				return errors.Wrap(errNotFound, "very wrap")
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+				require.Equal(t, "not_found: very wrap: such missing (ERR_67890)", err.Error())
+			},
+		},
+		{
+			name:              "unary: with interceptor: connect error",
+			noClientIntercept: true,
+			errFn: func() error {
+				cerr := connect.NewError(connect.CodeNotFound, errors.New("such test"))
+				cerr.Meta().Set("X-Candy", "chocolate")
+				return cerr
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				cerr := new(connect.Error)
+				require.True(t, errors.As(err, &cerr))
+				require.Equal(t, connect.CodeNotFound, cerr.Code())
+				require.Equal(t, "not_found: such test", cerr.Error())
+				require.Equal(t, "chocolate", cerr.Meta().Get("X-Candy"))
+				require.Len(t, cerr.Details(), 1)
+			},
+		},
+		{
+			name: "unary: with interceptor: connect error decoded",
+			errFn: func() error {
+				return connect.NewError(connect.CodeNotFound, errors.New("such test"))
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.Buy(ctx, 0)
+				require.True(t, isFudge(err))
+				require.Equal(t, "rpc error: not_found: such test", err.Error())
+			},
+		},
+		{
+			name: "stream from: nil",
+			errFn: func() error {
+				return nil
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				candy, err := client.StreamCandyFrom(ctx)
+				require.Nil(t, err)
+				require.Equal(t, []string{"chocolate", "gummy", "lollipop"}, candy)
+			},
+		},
+		{
+			name: "stream from: context canceled",
+			errFn: func() error {
+				return context.Canceled
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				candy, err := client.StreamCandyFrom(ctx)
+				require.True(t, isFudge(err))
+				require.ErrorIs(t, err, context.Canceled)
+				require.Equal(t, "rpc error: context canceled", err.Error())
+				require.Nil(t, candy)
+			},
+		},
+		{
+			name: "stream from: fudge sentinel error",
+			errFn: func() error {
+				return errors.Wrap(errSentinel, "")
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				candy, err := client.StreamCandyFrom(ctx)
+				require.True(t, isFudge(err))
+				require.ErrorIs(t, err, errSentinel)
+				require.Equal(t, "rpc error: such test (ERR_12345)", err.Error())
+				require.Nil(t, candy)
+			},
+		},
+		{
+			name: "stream to: nil",
+			errFn: func() error {
+				return nil
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.StreamCandyTo(ctx, []string{"whispers"})
+				require.Nil(t, err)
+			},
+		},
+		{
+			name: "stream to: fudge sentinel error",
+			errFn: func() error {
+				return errors.Wrap(errSentinel, "")
+			},
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.StreamCandyTo(ctx, []string{"whispers"})
+				require.True(t, isFudge(err))
+				require.ErrorIs(t, err, errSentinel)
+				require.Equal(t, "rpc error: such test (ERR_12345)", err.Error())
+			},
+		},
+		{
+			name: "stream to: in stock",
+			expFn: func(t *testing.T, client *connecttest.Client) {
+				err := client.StreamCandyTo(ctx, []string{"chocolate"})
+				require.True(t, isFudge(err))
+				require.Equal(t, "rpc error: already in stock", err.Error())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handlerOpts []connect.HandlerOption
+			var clientOpts []connect.ClientOption
+			if !tt.noServerIntercept {
+				handlerOpts = append(handlerOpts,
+					connect.WithInterceptors(errorsconnect.NewInterceptor()))
+			}
+			if !tt.noClientIntercept {
+				clientOpts = append(clientOpts,
+					connect.WithInterceptors(errorsconnect.NewInterceptor()))
+			}
+
+			hsvr := httptest.NewUnstartedServer(nil)
+			url := "http://" + hsvr.Listener.Addr().String()
+
+			svr := connecttest.NewServer(url,
+				connect.WithInterceptors(errorsconnect.NewInterceptor()))
+			svr.SetErrFn(tt.errFn)
+
+			hsvr.Config.Handler = svr.Handler(handlerOpts...)
+			hsvr.Start()
+			defer hsvr.Close()
+
+			client := connecttest.NewClient(url, clientOpts...)
+			tt.expFn(t, client)
+		})
+	}
+}
+
+func isFudge(err error) bool {
+	_, ok := err.(*errors.Error)
+	return ok
+}
+
+// eofConn is a streaming client connection that has reached the end of the
+// stream
+type eofConn struct {
+	connect.StreamingClientConn
+}
+
+func (eofConn) Send(any) error      { return io.EOF }
+func (eofConn) Receive(any) error   { return io.EOF }
+func (eofConn) CloseRequest() error { return io.EOF }
+
+func TestStreamingClientEOF(t *testing.T) {
+	next := func(context.Context, connect.Spec) connect.StreamingClientConn {
+		return eofConn{}
+	}
+	conn := errorsconnect.NewInterceptor().WrapStreamingClient(next)(context.Background(), connect.Spec{})
+
+	// NB: Callers compare against io.EOF so it must not be wrapped.
+	require.True(t, conn.Receive(nil) == io.EOF)
+	require.True(t, conn.Send(nil) == io.EOF)
+	require.True(t, conn.CloseRequest() == io.EOF)
+}
@@ -0,0 +1,92 @@
+package connect
+
+import (
+	"connectrpc.com/connect"
+	"github.com/rossmacarthur/fudge/errors"
+	"github.com/rossmacarthur/fudge/errors/codes"
+	"github.com/rossmacarthur/fudge/internal/fudgepb"
+)
+
+// interceptClient tries converting the error to a Connect error and if it can
+// then it extracts any Fudge information out of the details. Otherwise the
+// error is simply wrapped to add a stack trace.
+func interceptClient(err error) error {
+	if err == nil {
+		return nil
+	}
+	cerr := new(connect.Error)
+	if !errors.As(err, &cerr) {
+		// Not a Connect error
+		return errors.Wrap(err, "")
+	}
+	return FromError(cerr)
+}
+
+// interceptServer converts the error into a Connect error. Any Fudge error
+// information is encoded in the Connect error details along with the metadata
+// for this hop.
+func interceptServer(spec connect.Spec, peer connect.Peer, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// NB: A Connect error returned by the handler is reused so that its code,
+	// metadata and any other details are kept.
+	cerr := new(connect.Error)
+	if !errors.As(err, &cerr) {
+		cerr = connect.NewError(connect.Code(codes.Of(err)), err)
+	}
+
+	d, derr := connect.NewErrorDetail(fudgepb.ToProtoWithMetadata(err,
+		fudgepb.NewMetadata(spec.Procedure, peer.Addr)))
+	if derr != nil {
+		// TODO: Log in this case?
+		return cerr
+	}
+	cerr.AddDetail(d)
+
+	return cerr
+}
+
+// Limits bounds the size of the Fudge information decoded from the details.
+type Limits = fudgepb.Limits
+
+// DefaultLimits returns the limits used by FromError and the interceptor. The
+// result is a copy so changing it has no effect on them, instead pass it to
+// FromErrorWithLimits.
+func DefaultLimits() Limits {
+	return fudgepb.DefaultLimits
+}
+
+// FromError converts a Connect error into an error by extracting any Fudge
+// information from the details.
+func FromError(cerr *connect.Error) error {
+	return FromErrorWithLimits(cerr, fudgepb.DefaultLimits)
+}
+
+// FromErrorWithLimits is like FromError but the Fudge information is
+// validated against the given limits. If the information is invalid then the
+// readable parts are still returned.
+func FromErrorWithLimits(cerr *connect.Error, l Limits) error {
+	if cerr == nil {
+		return nil
+	}
+
+	// NB: Use the last Fudge detail, the server interceptor adds one to any
+	// Connect error returned by the handler which may already have one.
+	details := cerr.Details()
+	for i := len(details) - 1; i >= 0; i-- {
+		v, err := details[i].Value()
+		if err != nil {
+			continue
+		}
+		pb, ok := v.(*fudgepb.Error)
+		if !ok {
+			continue
+		}
+		// NB: Don't wrap because we want to start a new hop.
+		return errors.NewWithCause("rpc error", fudgepb.FromProtoWithLimits(pb, l))
+	}
+
+	return errors.Wrap(cerr, "")
+}
@@ -15,6 +15,9 @@ type Error struct {
 	Code string
 	// Cause is the original non-Fudge error (can be nil)
 	Cause error
+	// Metadata is the hop information recorded by the RPC server interceptors
+	// (can be nil)
+	Metadata *Metadata
 	// Trace is the stack trace
 	//
 	// contextual messages and key values are attached to individual stack frames
@@ -30,6 +33,9 @@ func (e *Error) Unwrap() error {
 // clone deep copies the error
 func (e *Error) clone() *Error {
 	c := *e
+	if e.Metadata != nil {
+		c.Metadata = e.Metadata.clone()
+	}
 	c.Trace = make([]Frame, 0, len(e.Trace))
 	for _, f := range e.Trace {
 		c.Trace = append(c.Trace, *f.clone())
@@ -54,43 +60,36 @@ func (e *Error) Is(target error) bool {
 	return e == t
 }
 
+// Error implements the error interface and returns the full message
+// regardless of the formatter.
 func (e *Error) Error() string {
-	return fmt.Sprintf("%s", e)
+	return e.fullMessage()
 }
 
 // Format implements the fmt.Formatter interface
 //
-// The following verbs are supported:
+// The 'v' and 's' verbs are formatted using the current Formatter, see
+// SetFormatter. With the DefaultFormatter the following verbs are supported:
 //
 //	%v, %s: print the wrapping messages and error message
-//	%+v, %+s: print the error message and stack trace with wrapping messages
-//	%#v, %#s: print the error message and stack trace with wrapping messages and key values
+//	%+v, %+s: print the error message, hop metadata and stack trace with wrapping messages
+//	%#v, %#s: print the error message, hop metadata and stack trace with wrapping messages and key values
 func (e *Error) Format(s fmt.State, verb rune) {
 	switch verb {
 	case 'v', 's':
-		fmt.Fprintf(s, "%s", e.fullMessage())
-
-		switch {
-		case s.Flag(int('+')):
-			for _, f := range e.Trace {
-				fmt.Fprint(s, "\n")
-				f.Format(s, verb)
-			}
-		case s.Flag(int('#')):
-			kvs := e.fullKeyValues()
-			if len(kvs) > 0 {
-				fmt.Fprintf(s, " {%v}", kvs)
-			}
-			for _, f := range e.Trace {
-				fmt.Fprint(s, "\n")
-				f.Format(s, verb)
-			}
-		}
+		CurrentFormatter().FormatError(s, verb, e)
 	default:
 		fmt.Fprintf(s, "%%!%c(*errors.Error=%s)", verb, e.fullMessage())
 	}
 }
 
+// formatMetadata prints the hop metadata header if there is any
+func (e *Error) formatMetadata(s fmt.State) {
+	if !e.Metadata.isEmpty() {
+		fmt.Fprintf(s, "\nhop: %v", *e.Metadata)
+	}
+}
+
 // FormatCustom visits each frame context message in reverse order, then the
 // primary error message and then finally the cause.
 //
@@ -114,6 +113,19 @@ func (e *Error) FormatCustom(visit func(message string)) {
 
 // fullMessage returns the full error message
 func (e *Error) fullMessage() string {
+	return e.message(true, palette{})
+}
+
+// hopMessage returns the error message for this hop only, i.e. excluding the
+// message of the next hop but including the message of a non-Fudge cause.
+func (e *Error) hopMessage(p palette) string {
+	next, _ := nextHop(e.Cause)
+	return e.message(next == nil, p)
+}
+
+// message returns the wrapping messages and error message optionally followed
+// by the message of the cause. The code is painted using the palette.
+func (e *Error) message(withCause bool, p palette) string {
 	var s strings.Builder
 
 	write := func(m string) {
@@ -133,25 +145,99 @@ func (e *Error) fullMessage() string {
 	if e.Message != "" {
 		write(e.Message)
 		if e.Code != "" {
-			s.WriteString(" (")
-			s.WriteString(e.Code)
-			s.WriteString(")")
+			s.WriteString(" ")
+			s.WriteString(p.paint(p.code, "("+e.Code+")"))
 		}
 	}
-	if e.Cause != nil {
+	if withCause && e.Cause != nil {
 		write(e.Cause.Error())
 	}
 
 	return s.String()
 }
 
-// fullKeyValues returns the full key values
-func (e *Error) fullKeyValues() KeyValues {
-	kvs := make(KeyValues)
-	for i := len(e.Trace) - 1; i >= 0; i-- {
-		for k, v := range e.Trace[i].KeyValues {
-			kvs[k] = v
+// hops returns the error followed by each Fudge error in the cause chain, i.e.
+// one error for each hop.
+//
+// Non-Fudge errors that wrap a Fudge error, e.g. using fmt.Errorf with %w, are
+// looked through. If they add to the message then they are included as hops
+// with only a message.
+func (e *Error) hops() []*Error {
+	hops := []*Error{e}
+	for {
+		next, wrappers := nextHop(e.Cause)
+		if next == nil {
+			return hops
+		}
+		hops = append(hops, wrapperHops(wrappers, next)...)
+		hops = append(hops, next)
+		e = next
+	}
+}
+
+// wrapperHops returns a hop with only a message for each of the non-Fudge
+// wrappers of the next hop that adds to the message, see nextHop.
+func wrapperHops(wrappers []error, next *Error) []*Error {
+	var hops []*Error
+	for i, w := range wrappers {
+		var inner error = next
+		if i+1 < len(wrappers) {
+			inner = wrappers[i+1]
+		}
+		if m := wrapperMessage(w, inner); m != "" {
+			hops = append(hops, &Error{Message: m})
 		}
 	}
-	return kvs
+	return hops
+}
+
+// nextHop returns the first Fudge error in the chain of the error and the
+// non-Fudge errors that wrap it. It returns nil if there is no Fudge error.
+//
+// NB: Only errors that wrap a single error are looked through.
+func nextHop(err error) (*Error, []error) {
+	var wrappers []error
+	for err != nil {
+		if ferr, ok := err.(*Error); ok {
+			return ferr, wrappers
+		}
+		wrappers = append(wrappers, err)
+		err = Unwrap(err)
+	}
+	return nil, nil
+}
+
+// wrapperMessage returns the message that the non-Fudge wrapper adds to the
+// message of the inner error, e.g. "such context" for an error created with
+// fmt.Errorf("such context: %w", err). If the wrapper's message doesn't end
+// with the message of the inner error then the whole message is returned.
+func wrapperMessage(w, inner error) string {
+	m, im := w.Error(), inner.Error()
+	if m == im {
+		return ""
+	}
+	if prefix, ok := strings.CutSuffix(m, ": "+im); ok {
+		return prefix
+	}
+	return m
+}
+
+// code returns the first sentinel code in the hops
+func (e *Error) code() string {
+	for _, hop := range e.hops() {
+		if hop.Code != "" {
+			return hop.Code
+		}
+	}
+	return ""
+}
+
+// fullKeyValues returns the key values of all the frames merged from the
+// innermost frame to the outermost one, see MergeKeyValues
+func (e *Error) fullKeyValues() KeyValues {
+	depths := make([]KeyValues, 0, len(e.Trace))
+	for _, f := range e.Trace {
+		depths = append(depths, f.KeyValues)
+	}
+	return MergeKeyValues(depths...)
 }
@@ -62,6 +62,10 @@ func NewWithCause(msg string, cause error, opts ...fudge.Option) error {
 //   - inline Fudge error then the stack trace is extended and/or annotated
 //   - non-Fudge error it is converted to a Fudge error and a trace back is
 //     added and the original error is available via the Unwrap method.
+//
+// Any Fudge errors wrapped by a non-Fudge error, e.g. using fmt.Errorf with
+// %w, are kept as is. They are formatted and sent over the wire as separate
+// hops instead of being flattened into the message.
 func Wrap(err error, msg string, opts ...fudge.Option) error {
 	if err == nil {
 		return nil
@@ -106,7 +110,7 @@ func findCallSite(e *Error, skip int) *Frame {
 	c := call(skip + 1)
 
 	for i, f := range e.Trace {
-		if f.File == c.File && f.Function == c.Function && f.Line == c.Line {
+		if sameCall(f, *c) {
 			return &e.Trace[i]
 		}
 	}
@@ -117,7 +121,7 @@ func findCallSite(e *Error, skip int) *Frame {
 outer:
 	for _, f := range trace {
 		for j, g := range e.Trace {
-			if f.File == g.File && f.Function == g.Function && f.Line == g.Line {
+			if sameCall(f, g) {
 				e.Trace = append(e.Trace[:j], trace...)
 				break outer
 			}
@@ -125,7 +129,7 @@ outer:
 	}
 
 	for i, f := range e.Trace {
-		if f.File == c.File && f.Function == c.Function && f.Line == c.Line {
+		if sameCall(f, *c) {
 			return &e.Trace[i]
 		}
 	}
@@ -133,6 +137,13 @@ outer:
 	panic("failed to find call site frame")
 }
 
+// sameCall reports whether the frames are the same call. The file is not
+// compared since it depends on the FilePathStyle at the time the frame was
+// captured.
+func sameCall(f, g Frame) bool {
+	return f.Package == g.Package && f.Function == g.Function && f.Line == g.Line
+}
+
 // Unwrap is the same as the standard library's errors.Unwrap.
 func Unwrap(err error) error {
 	return errors.Unwrap(err)
@@ -1,12 +1,19 @@
 package errors
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rossmacarthur/fudge"
+	"github.com/rossmacarthur/fudge/internal/stack"
 
 	"github.com/stretchr/testify/require"
 )
@@ -29,7 +36,7 @@ func TestNew(t *testing.T) {
 		fudge.KV("this", "that"),
 		fudge.MKV{"other": "thing"})
 	s := digits.ReplaceAllString(fmt.Sprintf("%#v", err), ":XXX")
-	require.Equal(t, `such test {key:value, other:thing, this:that}
+	require.Equal(t, `such test {key:value, this:that, other:thing}
 github.com/rossmacarthur/fudge/errors/errors_test.go:XXX TestNew
 testing/testing.go:XXX tRunner
 runtime/asm:XXX goexit`, s)
@@ -150,6 +157,33 @@ runtime/asm:XXX goexit`,
 	}
 }
 
+func TestFormatMetadata(t *testing.T) {
+	err := New("such test", fudge.KV("key", "value"))
+	ferr := err.(*Error)
+	ferr.Metadata = &Metadata{
+		Method:   "/candystore.CandyStore/Buy",
+		Peer:     "127.0.0.1:1337",
+		Time:     time.Date(2023, 5, 22, 13, 37, 0, 0, time.UTC),
+		Revision: "0a6834a",
+	}
+
+	hop := "hop: method=/candystore.CandyStore/Buy peer=127.0.0.1:1337 time=2023-05-22T13:37:00Z revision=0a6834a"
+
+	lines := strings.SplitN(fmt.Sprintf("%+v", err), "\n", 3)
+	require.Equal(t, "such test", lines[0])
+	require.Equal(t, hop, lines[1])
+	s := digits.ReplaceAllString(lines[2], ":XXX")
+	require.Equal(t, `github.com/rossmacarthur/fudge/errors/errors_test.go:XXX TestFormatMetadata
+testing/testing.go:XXX tRunner
+runtime/asm:XXX goexit`, s)
+
+	lines = strings.SplitN(fmt.Sprintf("%#v", err), "\n", 3)
+	require.Equal(t, "such test {key:value}", lines[0])
+	require.Equal(t, hop, lines[1])
+
+	require.Equal(t, "such test", err.Error())
+}
+
 func TestIs(t *testing.T) {
 	// local
 	errTest := New("test error")
@@ -212,3 +246,534 @@ func TestAs(t *testing.T) {
 	require.True(t, As(serr, &ts))
 	require.False(t, As(serr, &te))
 }
+
+func TestRegisterSentinel(t *testing.T) {
+	errDriver := &stringError{msg: "driver: bad connection"}
+	RegisterSentinel("errors.errDriver", errDriver)
+
+	err, ok := LookupSentinel("errors.errDriver")
+	require.True(t, ok)
+	require.Equal(t, errDriver, err)
+
+	code, ok := SentinelCode(Wrap(errDriver, "very wrap"))
+	require.True(t, ok)
+	require.Equal(t, "errors.errDriver", code)
+
+	code, ok = SentinelCode(Wrap(io.EOF, "very wrap"))
+	require.True(t, ok)
+	require.Equal(t, "io.EOF", code)
+
+	_, ok = SentinelCode(New("such test"))
+	require.False(t, ok)
+
+	require.Panics(t, func() { RegisterSentinel("io.EOF", io.ErrUnexpectedEOF) })
+	require.Panics(t, func() { RegisterSentinel("", io.EOF) })
+	require.Panics(t, func() { RegisterSentinel("errors.nil", nil) })
+}
+
+func TestFormatters(t *testing.T) {
+	err := &Error{
+		Binary: "client",
+		Cause: &Error{
+			Binary:  "server",
+			Message: "not found",
+			Code:    "ERR_1234",
+			Metadata: &Metadata{
+				Method: "/candystore.CandyStore/Buy",
+				Peer:   "127.0.0.1:1337",
+			},
+			Trace: []Frame{
+				{File: "server.go", Function: "main.buy", Line: 12, Message: "very wrap", KeyValues: KeyValues{{Key: "candy", Value: "gum"}}},
+				{File: "server.go", Function: "main.main", Line: 34},
+			},
+		},
+		Trace: []Frame{
+			{File: "client.go", Function: "main.call", Line: 56, Message: "rpc error", KeyValues: KeyValues{{Key: "retry", Value: "false"}}},
+			{File: "client.go", Function: "main.main", Line: 78},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		formatter Formatter
+		format    string
+		exp       string
+	}{
+		{
+			name:      "default %v",
+			formatter: DefaultFormatter,
+			format:    "%v",
+			exp:       `rpc error: very wrap: not found (ERR_1234)`,
+		},
+		{
+			name:      "default %+v",
+			formatter: DefaultFormatter,
+			format:    "%+v",
+			exp: `rpc error: very wrap: not found (ERR_1234)
+client.go:56 main.call
+client.go:78 main.main
+
+caused by: very wrap: not found (ERR_1234)
+hop: method=/candystore.CandyStore/Buy peer=127.0.0.1:1337
+server.go:12 main.buy
+server.go:34 main.main`,
+		},
+		{
+			name:      "default %#v",
+			formatter: DefaultFormatter,
+			format:    "%#v",
+			exp: `rpc error: very wrap: not found (ERR_1234) {retry:false}
+client.go:56 main.call
+client.go:78 main.main
+
+caused by: very wrap: not found (ERR_1234) {candy:gum}
+hop: method=/candystore.CandyStore/Buy peer=127.0.0.1:1337
+server.go:12 main.buy
+server.go:34 main.main`,
+		},
+		{
+			name:      "default %+.1v",
+			formatter: DefaultFormatter,
+			format:    "%+.1v",
+			exp: `rpc error: very wrap: not found (ERR_1234)
+client.go:56 main.call
+
+caused by: very wrap: not found (ERR_1234)
+hop: method=/candystore.CandyStore/Buy peer=127.0.0.1:1337
+server.go:12 main.buy`,
+		},
+		{
+			name:      "default %+4.1v",
+			formatter: DefaultFormatter,
+			format:    "%+4.1v",
+			exp: `rpc error: very wrap: not found (ERR_1234)
+    client.go:56 main.call
+
+caused by: very wrap: not found (ERR_1234)
+hop: method=/candystore.CandyStore/Buy peer=127.0.0.1:1337
+    server.go:12 main.buy`,
+		},
+		{
+			name:      "compact %v",
+			formatter: CompactFormatter,
+			format:    "%v",
+			exp:       `rpc error: very wrap: not found (ERR_1234) at client.go:56 main.call`,
+		},
+		{
+			name:      "compact %#v",
+			formatter: CompactFormatter,
+			format:    "%#v",
+			exp:       `rpc error: very wrap: not found (ERR_1234) {retry:false} at client.go:56 main.call`,
+		},
+		{
+			name:      "compact %.0v",
+			formatter: CompactFormatter,
+			format:    "%.0v",
+			exp:       `rpc error: very wrap: not found (ERR_1234)`,
+		},
+		{
+			name:      "multiline %v",
+			formatter: MultilineFormatter,
+			format:    "%v",
+			exp: `rpc error: very wrap: not found (ERR_1234)
+  [client] rpc error
+  [server] very wrap: not found (ERR_1234)`,
+		},
+		{
+			name:      "multiline %+v",
+			formatter: MultilineFormatter,
+			format:    "%+v",
+			exp: `rpc error: very wrap: not found (ERR_1234)
+  [client] rpc error
+    client.go:56 main.call
+    client.go:78 main.main
+  [server] very wrap: not found (ERR_1234)
+    hop: method=/candystore.CandyStore/Buy peer=127.0.0.1:1337
+    server.go:12 main.buy
+    server.go:34 main.main`,
+		},
+		{
+			name:      "multiline %#4.1v",
+			formatter: MultilineFormatter,
+			format:    "%#4.1v",
+			exp: `rpc error: very wrap: not found (ERR_1234)
+    [client] rpc error {retry:false}
+        client.go:56 main.call
+    [server] very wrap: not found (ERR_1234) {candy:gum}
+        hop: method=/candystore.CandyStore/Buy peer=127.0.0.1:1337
+        server.go:12 main.buy`,
+		},
+		{
+			name:      "trace %#v",
+			formatter: TraceFormatter,
+			format:    "%#v",
+			exp: `rpc error: very wrap: not found (ERR_1234)
+  [client] rpc error
+    client.go:56 main.call
+      rpc error {retry:false}
+    client.go:78 main.main
+  [server] very wrap: not found (ERR_1234)
+    hop: method=/candystore.CandyStore/Buy peer=127.0.0.1:1337
+    server.go:12 main.buy
+      very wrap {candy:gum}
+    server.go:34 main.main`,
+		},
+		{
+			name:      "logfmt %v",
+			formatter: LogfmtFormatter,
+			format:    "%v",
+			exp:       `msg="rpc error: very wrap: not found (ERR_1234)" code=ERR_1234`,
+		},
+		{
+			name:      "logfmt %+v",
+			formatter: LogfmtFormatter,
+			format:    "%+v",
+			exp:       `msg="rpc error: very wrap: not found (ERR_1234)" code=ERR_1234 binary=client stack="client.go:56 main.call, client.go:78 main.main"`,
+		},
+		{
+			name:      "logfmt %#.1v",
+			formatter: LogfmtFormatter,
+			format:    "%#.1v",
+			exp:       `msg="rpc error: very wrap: not found (ERR_1234)" code=ERR_1234 retry=false binary=client stack="client.go:56 main.call"`,
+		},
+		{
+			name:      "json %v",
+			formatter: JSONFormatter,
+			format:    "%v",
+			exp:       `{"message":"rpc error","cause":{"message":"very wrap: not found (ERR_1234)","code":"ERR_1234"}}`,
+		},
+		{
+			name:      "json %+.1v",
+			formatter: JSONFormatter,
+			format:    "%+.1v",
+			exp:       `{"message":"rpc error","binary":"client","trace":[{"file":"client.go","function":"main.call","line":56,"message":"rpc error"}],"cause":{"message":"very wrap: not found (ERR_1234)","code":"ERR_1234","binary":"server","metadata":{"method":"/candystore.CandyStore/Buy","peer":"127.0.0.1:1337"},"trace":[{"file":"server.go","function":"main.buy","line":12,"message":"very wrap"}]}}`,
+		},
+		{
+			name:      "json %#2.1v",
+			formatter: JSONFormatter,
+			format:    "%#2.1v",
+			exp: `{
+  "message": "rpc error",
+  "binary": "client",
+  "keyValues": {
+    "retry": "false"
+  },
+  "trace": [
+    {
+      "file": "client.go",
+      "function": "main.call",
+      "line": 56,
+      "message": "rpc error"
+    }
+  ],
+  "cause": {
+    "message": "very wrap: not found (ERR_1234)",
+    "code": "ERR_1234",
+    "binary": "server",
+    "metadata": {
+      "method": "/candystore.CandyStore/Buy",
+      "peer": "127.0.0.1:1337"
+    },
+    "keyValues": {
+      "candy": "gum"
+    },
+    "trace": [
+      {
+        "file": "server.go",
+        "function": "main.buy",
+        "line": 12,
+        "message": "very wrap"
+      }
+    ]
+  }
+}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			SetFormatter(tc.formatter)
+			t.Cleanup(func() { SetFormatter(nil) })
+
+			require.Equal(t, tc.exp, fmt.Sprintf(tc.format, err))
+			require.Equal(t, "rpc error: very wrap: not found (ERR_1234)", err.Error())
+		})
+	}
+}
+
+func TestColorFormatter(t *testing.T) {
+	err := &Error{
+		Binary:  "server",
+		Message: "not found",
+		Code:    "ERR_1234",
+		Trace: []Frame{
+			{File: "example.com/candy/server.go", Function: "candy.buy", Line: 12, Message: "very wrap", KeyValues: KeyValues{{Key: "candy", Value: "gum"}}},
+			{File: "runtime/proc.go", Function: "runtime.main", Line: 250},
+		},
+	}
+
+	SetFormatter(&ColorFormatter{Module: "example.com/candy"})
+	t.Cleanup(func() { SetFormatter(nil) })
+
+	exp := "\x1b[1;31mvery wrap: not found (ERR_1234)\x1b[0m\n" +
+		"  \x1b[1;35m[server]\x1b[0m very wrap: not found \x1b[33m(ERR_1234)\x1b[0m {\x1b[36mcandy\x1b[0m:gum}\n" +
+		"    example.com/candy/server.go:12 \x1b[1mcandy.buy\x1b[0m\n" +
+		"    \x1b[2mruntime/proc.go:250 runtime.main\x1b[0m"
+	require.Equal(t, exp, fmt.Sprintf("%#v", err))
+	require.Equal(t, "very wrap: not found (ERR_1234)", err.Error())
+}
+
+func TestNewTerminalFormatter(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, ok := NewTerminalFormatter(f).(*ColorFormatter)
+	require.False(t, ok)
+
+	_, ok = NewTerminalFormatter(nil).(*ColorFormatter)
+	require.False(t, ok)
+}
+
+func TestSourceFormatter(t *testing.T) {
+	SetFormatter(&SourceFormatter{Lines: 1})
+	t.Cleanup(func() { SetFormatter(nil) })
+
+	err := New("such test")
+
+	// NB: Normalize the gutter since the width depends on the line numbers.
+	s := regexp.MustCompile(`(?m)^ +\d* \|`).ReplaceAllString(fmt.Sprintf("%+.2v", err), "      |")
+	s = digits.ReplaceAllString(s, ":XXX")
+	require.Equal(t, `such test
+  [errors.test] such test
+    github.com/rossmacarthur/fudge/errors/errors_test.go:XXX TestSourceFormatter
+      |
+      | 	err := New("such test")
+      | 	^
+      |
+    testing/testing.go:XXX tRunner`, s)
+
+	// remote hops are not annotated, even if the binary has the same name
+	ferr := err.(*Error)
+	ferr.Metadata = &Metadata{}
+	require.NotContains(t, fmt.Sprintf("%+v", ferr), "^")
+}
+
+type genericStore[T any] struct{}
+
+func (s *genericStore[T]) buy() error {
+	return New("such test")
+}
+
+func (s genericStore[T]) sell() error {
+	return func() error { return New("such test") }()
+}
+
+func genericLookup[K comparable, V any]() error {
+	return New("such test")
+}
+
+func TestSourceFormatterGeneric(t *testing.T) {
+	t.Cleanup(func() { SetFormatter(nil) })
+
+	tests := []struct {
+		err      error
+		function string
+	}{
+		{err: new(genericStore[int]).buy(), function: "(*genericStore[T]).buy"},
+		{err: genericStore[string]{}.sell(), function: "genericStore[T].sell.func1"},
+		{err: genericLookup[string, int](), function: "genericLookup[K, V]"},
+	}
+	for _, tt := range tests {
+		SetFormatter(&SourceFormatter{Lines: 1})
+		require.Contains(t, fmt.Sprintf("%+.1v", tt.err), " "+tt.function+"\n")
+
+		// NB: The type arguments are elided without the source.
+		SetFormatter(MultilineFormatter)
+		require.Contains(t, fmt.Sprintf("%+.1v", tt.err), "[...]")
+	}
+}
+
+func TestPanicFormatter(t *testing.T) {
+	SetFormatter(PanicFormatter)
+	t.Cleanup(func() { SetFormatter(nil) })
+
+	// NB: A replica of this binary is not local.
+	err := NewWithCause("rpc error", &Error{
+		Binary:   "errors.test",
+		Message:  "not found",
+		Metadata: &Metadata{Method: "/candy.Store/Buy"},
+		Trace: []Frame{
+			{File: "example.com/candy/server.go", Function: "(*Store[...]).Buy.func2.func1", Line: 12},
+			{File: "example.com/candy/v2/main.go", Function: "main", Line: 8, Package: "main", PC: 0x1234},
+		},
+	})
+
+	_, file, _, _ := runtime.Caller(0)
+	_, tRunner, _, _ := runtime.Caller(1)
+	s := digits.ReplaceAllString(fmt.Sprintf("%+.2v", err), ":XXX")
+	s = regexp.MustCompile(`\+0x[0-9a-f]+`).ReplaceAllString(s, "+0xXX")
+	require.Equal(t, `rpc error: not found
+
+goroutine 1 [errors.test]:
+github.com/rossmacarthur/fudge/errors.TestPanicFormatter(...)
+	`+file+`:XXX +0xXX
+testing.tRunner(...)
+	`+tRunner+`:XXX +0xXX
+
+goroutine 2 [errors.test]:
+example.com/candy.(*Store[...]).Buy.func2.1(...)
+	example.com/candy/server.go:XXX
+main.main(...)
+	example.com/candy/v2/main.go:XXX`, s)
+}
+
+func TestWrapForeign(t *testing.T) {
+	inner := Wrap(sentinelTest, "", fudge.KV("key", "value"))
+	err := Wrap(fmt.Errorf("such context: %w", inner), "very wrap")
+
+	require.True(t, Is(err, sentinelTest))
+	require.Equal(t, "very wrap: such context: test error (TEST1234)", err.Error())
+
+	s := digits.ReplaceAllString(fmt.Sprintf("%#.1v", err), ":XXX")
+	require.Equal(t, `very wrap: such context: test error (TEST1234)
+github.com/rossmacarthur/fudge/errors/errors_test.go:XXX TestWrapForeign
+
+caused by: such context
+
+caused by: test error (TEST1234) {key:value}
+github.com/rossmacarthur/fudge/errors/errors_test.go:XXX TestWrapForeign`, s)
+
+	// wrappers that don't add a message are not hops
+	err = Wrap(fmt.Errorf("%w", inner), "very wrap")
+	s = digits.ReplaceAllString(fmt.Sprintf("%+.0v", err), ":XXX")
+	require.Equal(t, `very wrap: test error (TEST1234)
+
+caused by: test error (TEST1234)`, s)
+}
+
+func TestKeyValuePolicy(t *testing.T) {
+	newErr := func() error {
+		return New("such test", fudge.KV("id", 1), fudge.KV("key", "value"))
+	}
+
+	tests := []struct {
+		name   string
+		policy KeyValuePolicy
+		exp    string
+	}{
+		{
+			name:   "keep all values",
+			policy: KeepAllValues,
+			exp:    "very wrap: such test {id:[1 2], key:value, other:thing}",
+		},
+		{
+			name:   "first value wins",
+			policy: FirstValueWins,
+			exp:    "very wrap: such test {id:1, key:value, other:thing}",
+		},
+		{
+			name:   "last value wins",
+			policy: LastValueWins,
+			exp:    "very wrap: such test {id:2, key:value, other:thing}",
+		},
+		{
+			name:   "namespace by depth",
+			policy: NamespaceByDepth,
+			exp:    "very wrap: such test {0.id:1, key:value, other:thing, 1.id:2}",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			SetKeyValuePolicy(tc.policy)
+			t.Cleanup(func() { SetKeyValuePolicy(KeepAllValues) })
+
+			err := Wrap(newErr(), "very wrap", fudge.KV("other", "thing"), fudge.KV("id", 2))
+			require.Equal(t, tc.exp, fmt.Sprintf("%#.0v", err))
+		})
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	var kvs KeyValues
+	kvs.set("b", "1")
+	kvs.set("a", "2")
+	kvs.set("b", "3")
+	require.Equal(t, KeyValues{{Key: "b", Value: "3"}, {Key: "a", Value: "2"}}, kvs)
+
+	kvs = append(kvs, KeyValue{Key: "a", Value: "4"})
+	v, ok := kvs.Get("a")
+	require.True(t, ok)
+	require.Equal(t, "4", v)
+	_, ok = kvs.Get("c")
+	require.False(t, ok)
+
+	require.Equal(t, "b:3, a:[2 4]", fmt.Sprint(kvs))
+
+	bs, err := json.Marshal(kvs)
+	require.NoError(t, err)
+	require.Equal(t, `{"b":"3","a":["2","4"]}`, string(bs))
+}
+
+func TestSetFilePaths(t *testing.T) {
+	t.Cleanup(func() { SetFilePaths(ModulePaths) })
+
+	_, file, _, _ := runtime.Caller(0)
+
+	SetFilePaths(AbsolutePaths)
+	err := New("such test").(*Error)
+	require.Equal(t, file, err.Trace[0].File)
+	require.Equal(t, "TestSetFilePaths", err.Trace[0].Function)
+
+	// NB: The package can't be told from an absolute path.
+	require.Contains(t, fmt.Sprintf("%+v", err), ":"+fmt.Sprint(err.Trace[0].Line)+" github.com/rossmacarthur/fudge/errors.TestSetFilePaths\n")
+
+	SetFilePaths(ModulePaths, PathRewrite{Prefix: "github.com/rossmacarthur/", Replacement: "src/"})
+	err = New("such test").(*Error)
+	require.Equal(t, "src/fudge/errors/errors_test.go", err.Trace[0].File)
+
+	SetFilePaths(GOROOTPaths)
+	err = New("such test").(*Error)
+	require.Equal(t, "github.com/rossmacarthur/fudge/errors/errors_test.go", err.Trace[0].File)
+	require.Equal(t, "$GOROOT/src/testing/testing.go", err.Trace[1].File)
+}
+
+func TestWrapSetFilePaths(t *testing.T) {
+	t.Cleanup(func() { SetFilePaths(ModulePaths) })
+
+	err := func() error { return New("such test") }()
+	SetFilePaths(AbsolutePaths)
+	err = Wrap(err, "very wrap")
+	require.Equal(t, "very wrap: such test", err.Error())
+
+	var wrapped []Frame
+	for _, f := range err.(*Error).Trace {
+		if f.Message == "very wrap" {
+			wrapped = append(wrapped, f)
+		}
+	}
+	require.Len(t, wrapped, 1)
+	require.True(t, filepath.IsAbs(wrapped[0].File))
+}
+
+func deepError(depth int) error {
+	if depth == 0 {
+		return New("such test")
+	}
+	return deepError(depth - 1)
+}
+
+func TestDeepStack(t *testing.T) {
+	t.Cleanup(func() { SetFormatter(nil) })
+
+	err := deepError(1000).(*Error)
+	require.Len(t, err.Trace, stack.MaxFrames)
+	require.Equal(t, "deepError", err.Trace[0].Function)
+
+	elided := regexp.MustCompile(`\n\s*\.\.\.\d+ frames elided\.\.\.\n`)
+	for _, f := range []Formatter{DefaultFormatter, MultilineFormatter, PanicFormatter} {
+		SetFormatter(f)
+		require.Regexp(t, elided, fmt.Sprintf("%+v", err))
+	}
+}
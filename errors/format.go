@@ -0,0 +1,410 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formatter formats Fudge errors for the 'v' and 's' verbs.
+//
+// Formatters should interpret the fmt.State as follows:
+//
+//	%v: print the error message
+//	%+v: additionally print the hop metadata and stack trace
+//	%#v: additionally print the key values
+//	%+.5v: print at most 5 stack frames per hop
+//	%4v: the meaning of the width depends on the formatter
+//
+// Note that fmt requires the flags to come before the width and precision, so
+// %.5+v is not a valid verb.
+type Formatter interface {
+	FormatError(s fmt.State, verb rune, e *Error)
+}
+
+// FormatterFunc is an adapter to allow the use of ordinary functions as
+// formatters.
+type FormatterFunc func(s fmt.State, verb rune, e *Error)
+
+// FormatError implements the Formatter interface
+func (f FormatterFunc) FormatError(s fmt.State, verb rune, e *Error) {
+	f(s, verb, e)
+}
+
+var (
+	// DefaultFormatter prints the full message on the first line and then the
+	// hop metadata and stack trace of the outermost hop, one frame per line.
+	// Each inner hop follows after a "caused by" line with its own message,
+	// metadata and stack trace. The width sets the indentation of the frames.
+	DefaultFormatter Formatter = FormatterFunc(formatDefault)
+
+	// CompactFormatter prints the full message and the top stack frame on a
+	// single line. The width is ignored.
+	CompactFormatter Formatter = FormatterFunc(formatCompact)
+
+	// MultilineFormatter prints the full message on the first line and then
+	// each hop as an indented block. The width sets the indentation, which is
+	// two spaces by default.
+	MultilineFormatter Formatter = FormatterFunc(formatMultiline)
+
+	// TraceFormatter prints the same layout as the MultilineFormatter but the
+	// message and key values of each frame are printed under the frame
+	// instead of being merged into the hop. This shows exactly which function
+	// added each message and key value.
+	TraceFormatter Formatter = FormatterFunc(formatTrace)
+
+	// LogfmtFormatter prints the error as logfmt key values on a single line.
+	// The width is ignored.
+	LogfmtFormatter Formatter = FormatterFunc(formatLogfmt)
+
+	// JSONFormatter prints the error as a JSON object with a nested object for
+	// each hop. The width sets the indentation, by default the object is
+	// printed on a single line.
+	JSONFormatter Formatter = FormatterFunc(formatJSON)
+)
+
+// formatter is the process-wide formatter used by all Fudge errors.
+var formatter = struct {
+	sync.RWMutex
+	f Formatter
+}{
+	f: DefaultFormatter,
+}
+
+// SetFormatter sets the formatter used by all Fudge errors. If the formatter
+// is nil then the DefaultFormatter is restored.
+//
+// This function is intended to be called once at program startup. It does not
+// affect the Error method which always returns the full message.
+func SetFormatter(f Formatter) {
+	if f == nil {
+		f = DefaultFormatter
+	}
+
+	formatter.Lock()
+	defer formatter.Unlock()
+
+	formatter.f = f
+}
+
+// CurrentFormatter returns the formatter used by all Fudge errors.
+func CurrentFormatter() Formatter {
+	formatter.RLock()
+	defer formatter.RUnlock()
+
+	return formatter.f
+}
+
+// formatDefault is the original Fudge layout extended to multiple hops. Each
+// inner hop, e.g. returned over gRPC or wrapped by a non-Fudge error, is
+// printed after the outermost one starting with a "caused by" line.
+func formatDefault(s fmt.State, _ rune, e *Error) {
+	io.WriteString(s, e.fullMessage())
+	if !s.Flag('+') && !s.Flag('#') {
+		return
+	}
+
+	prefix := indent(s, 0)
+	for i, hop := range e.hops() {
+		if i > 0 {
+			io.WriteString(s, "\n\ncaused by: "+hop.hopMessage(palette{}))
+		}
+		if s.Flag('#') {
+			kvs := hop.fullKeyValues()
+			if len(kvs) > 0 {
+				fmt.Fprintf(s, " {%v}", kvs)
+			}
+		}
+		hop.formatMetadata(s)
+		for _, f := range limitFrames(s, hop.Trace) {
+			fmt.Fprintf(s, "\n%s%v", prefix, f)
+		}
+	}
+}
+
+// formatCompact prints the full message followed by the top stack frame and,
+// if requested, the hop metadata.
+func formatCompact(s fmt.State, _ rune, e *Error) {
+	io.WriteString(s, e.fullMessage())
+
+	if s.Flag('#') {
+		kvs := e.fullKeyValues()
+		if len(kvs) > 0 {
+			fmt.Fprintf(s, " {%v}", kvs)
+		}
+	}
+	if frames := limitFrames(s, e.Trace); len(frames) > 0 {
+		fmt.Fprintf(s, " at %v", frames[0])
+	}
+	if (s.Flag('+') || s.Flag('#')) && !e.Metadata.isEmpty() {
+		fmt.Fprintf(s, " [%v]", *e.Metadata)
+	}
+}
+
+// formatMultiline prints the full message followed by a block for each hop
+// containing the binary and message, and if requested the hop metadata and
+// stack trace.
+func formatMultiline(s fmt.State, _ rune, e *Error) {
+	hopLayout{}.format(s, e)
+}
+
+// hopLayout is the layout of the MultilineFormatter which is shared by the
+// ColorFormatter and SourceFormatter.
+type hopLayout struct {
+	// p is used to paint each part of the error
+	p palette
+	// own reports whether the frame is in the module, other frames are
+	// painted as library frames (can be nil)
+	own func(Frame) bool
+	// source is the number of lines of source code to print before and after
+	// each frame (can be zero)
+	source int
+	// frames prints the message and key values of each frame under the frame
+	// instead of merging them into the hop
+	frames bool
+}
+
+func (l hopLayout) format(s fmt.State, e *Error) {
+	p := l.p
+	io.WriteString(s, p.paint(p.message, e.fullMessage()))
+
+	verbose := s.Flag('+') || s.Flag('#')
+	prefix := indent(s, 2)
+	for _, hop := range e.hops() {
+		io.WriteString(s, "\n"+prefix)
+		if hop.Binary != "" {
+			io.WriteString(s, p.paint(p.hop, "["+hop.Binary+"]")+" ")
+		}
+		io.WriteString(s, hop.hopMessage(p))
+
+		if s.Flag('#') && !l.frames {
+			kvs := hop.fullKeyValues()
+			if len(kvs) > 0 {
+				io.WriteString(s, " {"+p.keyValues(kvs)+"}")
+			}
+		}
+		if !verbose {
+			continue
+		}
+		if !hop.Metadata.isEmpty() {
+			io.WriteString(s, "\n"+prefix+prefix+p.paint(p.metadata, fmt.Sprintf("hop: %v", *hop.Metadata)))
+		}
+		// NB: Source is only available for hops in this binary, hops decoded
+		// from the wire always have metadata.
+		local := hop.Metadata == nil
+		for _, f := range limitFrames(s, hop.Trace) {
+			io.WriteString(s, "\n"+prefix+prefix)
+			if f.elided() {
+				io.WriteString(s, p.paint(p.library, f.Function))
+				continue
+			}
+			function := f.qualifiedFunction()
+			if l.source > 0 && local {
+				function = fillTypeParams(f, function)
+			}
+			if l.own == nil || l.own(f) {
+				fmt.Fprintf(s, "%s:%d %s", f.File, f.Line, p.paint(p.function, function))
+			} else {
+				io.WriteString(s, p.paint(p.library, fmt.Sprintf("%s:%d %s", f.File, f.Line, function)))
+			}
+			if l.frames {
+				l.formatFrame(s, f, prefix+prefix+prefix)
+			}
+			if l.source > 0 && local {
+				if src, ok := readSource(f, l.source); ok {
+					src.format(s, prefix+prefix+prefix, p)
+				}
+			}
+		}
+	}
+}
+
+// formatFrame prints the message of the frame and, if requested, the key
+// values of the frame on a single line
+func (l hopLayout) formatFrame(s fmt.State, f Frame, prefix string) {
+	var parts []string
+	if f.Message != "" {
+		parts = append(parts, l.p.paint(l.p.wrap, f.Message))
+	}
+	if s.Flag('#') && len(f.KeyValues) > 0 {
+		parts = append(parts, "{"+l.p.keyValues(f.KeyValues)+"}")
+	}
+	if len(parts) > 0 {
+		io.WriteString(s, "\n"+prefix+strings.Join(parts, " "))
+	}
+}
+
+// formatTrace prints the same layout as formatMultiline but with the message
+// and key values of each frame under the frame.
+func formatTrace(s fmt.State, _ rune, e *Error) {
+	hopLayout{frames: true}.format(s, e)
+}
+
+// formatLogfmt prints the full message and code, and if requested the key
+// values, binary, hop metadata and stack trace of the outermost hop.
+func formatLogfmt(s fmt.State, _ rune, e *Error) {
+	var sep string
+	write := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(s, "%s%s=%s", sep, k, logfmtValue(v))
+			sep = " "
+		}
+	}
+
+	write("msg", e.fullMessage())
+	write("code", e.code())
+
+	if s.Flag('#') {
+		for _, g := range e.fullKeyValues().groups() {
+			write(g.key, g.value())
+		}
+	}
+	if !s.Flag('+') && !s.Flag('#') {
+		return
+	}
+
+	write("binary", e.Binary)
+	if m := e.Metadata; !m.isEmpty() {
+		write("method", m.Method)
+		write("peer", m.Peer)
+		if !m.Time.IsZero() {
+			write("time", m.Time.UTC().Format(time.RFC3339Nano))
+		}
+		write("version", m.Version)
+		write("revision", m.Revision)
+	}
+
+	var frames []string
+	for _, f := range limitFrames(s, e.Trace) {
+		frames = append(frames, fmt.Sprint(f))
+	}
+	write("stack", strings.Join(frames, ", "))
+}
+
+// logfmtValue quotes the value if necessary
+func logfmtValue(v string) string {
+	if strings.ContainsAny(v, " =\"\\") || strings.ContainsFunc(v, func(r rune) bool {
+		return r < ' ' || r == 0x7f
+	}) {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// jsonError is the JSON representation of a hop
+type jsonError struct {
+	Message   string        `json:"message,omitempty"`
+	Code      string        `json:"code,omitempty"`
+	Binary    string        `json:"binary,omitempty"`
+	Metadata  *jsonMetadata `json:"metadata,omitempty"`
+	KeyValues KeyValues     `json:"keyValues,omitempty"`
+	Trace     []jsonFrame   `json:"trace,omitempty"`
+	Cause     *jsonError    `json:"cause,omitempty"`
+}
+
+// jsonMetadata is the JSON representation of the hop metadata
+type jsonMetadata struct {
+	Method   string `json:"method,omitempty"`
+	Peer     string `json:"peer,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// jsonFrame is the JSON representation of a stack frame
+type jsonFrame struct {
+	File     string  `json:"file"`
+	Function string  `json:"function"`
+	Line     int     `json:"line"`
+	Package  string  `json:"package,omitempty"`
+	Receiver string  `json:"receiver,omitempty"`
+	PC       uintptr `json:"pc,omitempty"`
+	Inlined  bool    `json:"inlined,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// formatJSON prints each hop as a nested JSON object. The non-Fudge cause, if
+// there is one, is the innermost object with only a message.
+func formatJSON(s fmt.State, _ rune, e *Error) {
+	verbose := s.Flag('+') || s.Flag('#')
+
+	root := &jsonError{}
+	je := root
+	hops := e.hops()
+	for i, hop := range hops {
+		je.Message = hop.message(false, palette{})
+		je.Code = hop.Code
+		if s.Flag('#') {
+			je.KeyValues = hop.fullKeyValues()
+		}
+		if verbose {
+			je.Binary = hop.Binary
+			if m := hop.Metadata; !m.isEmpty() {
+				je.Metadata = &jsonMetadata{
+					Method:   m.Method,
+					Peer:     m.Peer,
+					Version:  m.Version,
+					Revision: m.Revision,
+				}
+				if !m.Time.IsZero() {
+					je.Metadata.Time = m.Time.UTC().Format(time.RFC3339Nano)
+				}
+			}
+			for _, f := range limitFrames(s, hop.Trace) {
+				je.Trace = append(je.Trace, jsonFrame{
+					File:     f.File,
+					Function: f.Function,
+					Line:     f.Line,
+					Package:  f.Package,
+					Receiver: f.Receiver,
+					PC:       f.PC,
+					Inlined:  f.Inlined,
+					Message:  f.Message,
+				})
+			}
+		}
+
+		if i < len(hops)-1 {
+			je.Cause = &jsonError{}
+			je = je.Cause
+		} else if hop.Cause != nil {
+			je.Cause = &jsonError{Message: hop.Cause.Error()}
+		}
+	}
+
+	var (
+		bs  []byte
+		err error
+	)
+	if w, ok := s.Width(); ok {
+		bs, err = json.MarshalIndent(root, "", strings.Repeat(" ", w))
+	} else {
+		bs, err = json.Marshal(root)
+	}
+	if err != nil {
+		fmt.Fprintf(s, "%%!(JSON=%s)", err)
+		return
+	}
+	s.Write(bs)
+}
+
+// indent returns the indentation set by the width or the default
+func indent(s fmt.State, def int) string {
+	w, ok := s.Width()
+	if !ok {
+		w = def
+	}
+	return strings.Repeat(" ", w)
+}
+
+// limitFrames returns at most the number of frames set by the precision
+func limitFrames(s fmt.State, t []Frame) []Frame {
+	if p, ok := s.Precision(); ok && p < len(t) {
+		return t[:p]
+	}
+	return t
+}
@@ -2,6 +2,8 @@ package errors
 
 import (
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/rossmacarthur/fudge/internal/stack"
 )
@@ -10,13 +12,27 @@ import (
 type Frame struct {
 	// File is the file name associated with the frame
 	File string
-	// function is the function name associated with the frame
+	// Function is the function name associated with the frame without the
+	// package, e.g. (*Server[...]).Buy.func1
 	Function string
 	// Line is the fine number associated with the frame
 	Line int
+	// Package is the import path of the package of the function (can be
+	// empty)
+	Package string
+	// Receiver is the receiver type if the function is a method or a closure
+	// within one, e.g. *Server[...] (can be empty)
+	Receiver string
+	// PC is the program counter of the frame, it is only meaningful in the
+	// binary that captured the frame (can be zero)
+	PC uintptr
+	// Inlined is true if the function was inlined into its caller, the PC is
+	// then within the caller
+	Inlined bool
 	// Message is the message associated with the frame (can be empty)
 	Message string
-	// KeyValues is a map of key-value pairs associated with the frame (can be nil)
+	// KeyValues is the key-value pairs associated with the frame in insertion
+	// order (can be nil)
 	KeyValues KeyValues
 }
 
@@ -28,19 +44,99 @@ func (f *Frame) clone() *Frame {
 	return &c
 }
 
+// isGlobal reports whether the stack trace was captured during package
+// initialization
 func isGlobal(t []Frame) bool {
 	for _, f := range t {
-		if f.File == "runtime/proc.go" && f.Function == "doInit" {
+		if f.Function != "doInit" {
+			continue
+		}
+		// NB: The file name depends on the FilePathStyle.
+		if src, ok := stack.Lookup(f.File); ok && src.Package == "runtime" {
 			return true
 		}
 	}
 	return false
 }
 
+// FilePathStyle determines how the file names of frames are recorded, see
+// SetFilePaths.
+type FilePathStyle int
+
+const (
+	// ModulePaths records the import path of the package followed by the base
+	// name of the file, e.g. github.com/acme/yak/shave/razor.go. This is the
+	// default.
+	ModulePaths FilePathStyle = iota
+	// AbsolutePaths records the absolute path of the file on the machine that
+	// built the binary, e.g. /home/acme/src/yak/shave/razor.go. Module paths
+	// are recorded if it is not known, e.g. when built with -trimpath.
+	AbsolutePaths
+	// GOROOTPaths records the files of the standard library relative to
+	// GOROOT, e.g. $GOROOT/src/runtime/proc.go, other files are recorded as
+	// module paths.
+	GOROOTPaths
+)
+
+// PathRewrite replaces the prefix of the file names of frames, e.g. to map
+// module paths back to the layout of a monorepo.
+type PathRewrite struct {
+	// Prefix is the prefix of the file name to replace
+	Prefix string
+	// Replacement is the string that replaces the prefix
+	Replacement string
+}
+
+// SetFilePaths sets how the file names of frames are recorded. The style is
+// applied first and then the first rewrite with a matching prefix. For
+// example:
+//
+//	errors.SetFilePaths(errors.ModulePaths, errors.PathRewrite{
+//		Prefix:      "github.com/acme/monorepo/",
+//		Replacement: "monorepo/",
+//	})
+//
+// This function is intended to be called once at program startup. It only
+// affects frames captured after it is called.
+func SetFilePaths(style FilePathStyle, rewrites ...PathRewrite) {
+	rs := make([]stack.Rewrite, 0, len(rewrites))
+	for _, r := range rewrites {
+		rs = append(rs, stack.Rewrite{Prefix: r.Prefix, Replacement: r.Replacement})
+	}
+	stack.SetPaths(stack.PathStyle(style), rs)
+}
+
+// elided reports whether the frame marks the frames elided from a deep stack
+// trace, e.g. "...42 frames elided..."
+func (f Frame) elided() bool {
+	return f.File == "" && f.Line == 0 && strings.HasPrefix(f.Function, "...")
+}
+
+// qualifiedFunction returns the function name qualified with the package if
+// the package can't be told from the file name, e.g. when the frame has an
+// absolute path. The main package and external test packages are not
+// qualified since they are in the directory of the file.
+func (f Frame) qualifiedFunction() string {
+	pkg := strings.TrimSuffix(f.Package, "_test")
+	if pkg == "" || pkg == "main" || path.Dir(f.File) == pkg {
+		return f.Function
+	}
+	return f.Package + "." + f.Function
+}
+
+// Format implements the fmt.Formatter interface
+//
+// The function is qualified with the package if the package can't be told
+// from the file name. The frame that marks the frames elided from a deep
+// stack trace is printed as only its function, e.g. "...42 frames elided...".
 func (f Frame) Format(s fmt.State, verb rune) {
 	switch verb {
 	case 'v', 's':
-		fmt.Fprintf(s, "%s:%d %s", f.File, f.Line, f.Function)
+		if f.elided() {
+			fmt.Fprint(s, f.Function)
+			return
+		}
+		fmt.Fprintf(s, "%s:%d %s", f.File, f.Line, f.qualifiedFunction())
 	default:
 		fmt.Fprintf(s, "%%!%c(Frame=%s:%d)", verb, f.File, f.Line)
 	}
@@ -53,6 +149,10 @@ func trace(skip int) []Frame {
 			File:     f.File,
 			Function: f.Function,
 			Line:     f.Line,
+			Package:  f.Package,
+			Receiver: f.Receiver,
+			PC:       f.PC,
+			Inlined:  f.Inlined,
 		})
 	}
 	return trace
@@ -64,5 +164,9 @@ func call(skip int) *Frame {
 		File:     f.File,
 		Function: f.Function,
 		Line:     f.Line,
+		Package:  f.Package,
+		Receiver: f.Receiver,
+		PC:       f.PC,
+		Inlined:  f.Inlined,
 	}
 }
@@ -0,0 +1,162 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/rossmacarthur/fudge/errors"
+	errorsgrpc "github.com/rossmacarthur/fudge/errors/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statuses is the table of sentinel errors mapped to HTTP status codes, in
+// registration order.
+var statuses struct {
+	sync.RWMutex
+	list []httpStatus
+}
+
+type httpStatus struct {
+	sentinel error
+	status   int
+}
+
+// RegisterHTTPStatus registers the HTTP status code that should be used when
+// an error matches the given sentinel error using Is.
+//
+// This function is intended to be called from an init function. Sentinels are
+// checked in registration order.
+func RegisterHTTPStatus(sentinel error, status int) {
+	statuses.Lock()
+	defer statuses.Unlock()
+	statuses.list = append(statuses.list, httpStatus{sentinel, status})
+}
+
+// Option configures the error handler.
+type Option func(*handler)
+
+// WithKeyValues includes the key values of the error in the response body.
+//
+// Key values can contain sensitive information so this should only be used
+// if the gateway is not exposed publicly.
+func WithKeyValues() Option {
+	return func(h *handler) {
+		h.keyValues = true
+	}
+}
+
+type handler struct {
+	keyValues bool
+}
+
+// Body is the JSON response body written by the error handler.
+type Body struct {
+	// Code is the sentinel error code (can be empty)
+	Code string `json:"code,omitempty"`
+	// Message is the public message, this is the sentinel error message if
+	// there is one otherwise the HTTP status text
+	Message string `json:"message"`
+	// KeyValues are the key values of the error (only if WithKeyValues is used)
+	KeyValues errors.KeyValues `json:"key_values,omitempty"`
+}
+
+// NewErrorHandler returns a grpc-gateway error handler that writes Fudge
+// errors as JSON.
+//
+// The HTTP status code is chosen using the status registered for the sentinel
+// error if there is one, otherwise it is derived from the gRPC code.
+func NewErrorHandler(opts ...Option) runtime.ErrorHandlerFunc {
+	h := new(handler)
+	for _, o := range opts {
+		o(h)
+	}
+	return h.handle
+}
+
+func (h *handler) handle(_ context.Context, _ *runtime.ServeMux,
+	_ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+
+	httpCode := -1
+	if herr := new(runtime.HTTPStatusError); errors.As(err, &herr) {
+		httpCode = herr.HTTPStatus
+		err = herr.Err
+	}
+
+	code := codes.Unknown
+	if s, ok := status.FromError(err); ok {
+		code = s.Code()
+		err = errorsgrpc.FromStatus(s)
+	} else if errors.Is(err, context.Canceled) {
+		code = codes.Canceled
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	}
+
+	if httpCode == -1 {
+		httpCode = httpStatusOf(err, code)
+	}
+
+	var body Body
+	if sentinel := sentinelOf(err); sentinel != nil {
+		body.Code = sentinel.Code
+		body.Message = sentinel.Message
+	} else {
+		body.Message = http.StatusText(httpCode)
+	}
+	if h.keyValues {
+		body.KeyValues = keyValuesOf(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// httpStatusOf returns the registered HTTP status for the error or the HTTP
+// status derived from the gRPC code.
+func httpStatusOf(err error, code codes.Code) int {
+	statuses.RLock()
+	defer statuses.RUnlock()
+
+	for _, s := range statuses.list {
+		if errors.Is(err, s.sentinel) {
+			return s.status
+		}
+	}
+
+	return runtime.HTTPStatusFromCode(code)
+}
+
+// sentinelOf returns the first Fudge error in the chain that has a code.
+func sentinelOf(err error) *errors.Error {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if ferr, ok := err.(*errors.Error); ok && ferr.Code != "" {
+			return ferr
+		}
+	}
+	return nil
+}
+
+// keyValuesOf returns the key values of all the Fudge errors in the chain
+// merged from the innermost frame to the outermost one, see
+// errors.MergeKeyValues.
+func keyValuesOf(err error) errors.KeyValues {
+	var chain []*errors.Error
+	for ; err != nil; err = errors.Unwrap(err) {
+		if ferr, ok := err.(*errors.Error); ok {
+			chain = append(chain, ferr)
+		}
+	}
+
+	var depths []errors.KeyValues
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, f := range chain[i].Trace {
+			depths = append(depths, f.KeyValues)
+		}
+	}
+	return errors.MergeKeyValues(depths...)
+}
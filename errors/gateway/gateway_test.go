@@ -0,0 +1,109 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/rossmacarthur/fudge"
+	"github.com/rossmacarthur/fudge/errors"
+	"github.com/rossmacarthur/fudge/errors/gateway"
+	"github.com/rossmacarthur/fudge/internal/fudgepb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errNotFound = errors.Sentinel("razor not found", "ERR_f2a2c5b0c3e1d4a7")
+	errOther    = errors.Sentinel("such test", "ERR_12345")
+)
+
+func init() {
+	gateway.RegisterHTTPStatus(errNotFound, http.StatusNotFound)
+}
+
+// statusErr returns the error as it would be received by the gateway from a
+// server using the gRPC server interceptors.
+func statusErr(code codes.Code, err error) error {
+	s, e := status.New(code, err.Error()).WithDetails(fudgepb.ToProto(err))
+	if e != nil {
+		panic(e)
+	}
+	return s.Err()
+}
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []gateway.Option
+		err       error
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:      "registered sentinel",
+			err:       statusErr(codes.Unknown, errors.Wrap(errNotFound, "very wrap", fudge.KV("yak_id", 1337))),
+			expStatus: http.StatusNotFound,
+			expBody:   `{"code":"ERR_f2a2c5b0c3e1d4a7","message":"razor not found"}`,
+		},
+		{
+			name:      "registered sentinel with key values",
+			opts:      []gateway.Option{gateway.WithKeyValues()},
+			err:       statusErr(codes.Unknown, errors.Wrap(errNotFound, "very wrap", fudge.KV("yak_id", 1337))),
+			expStatus: http.StatusNotFound,
+			expBody:   `{"code":"ERR_f2a2c5b0c3e1d4a7","message":"razor not found","key_values":{"yak_id":"1337"}}`,
+		},
+		{
+			name:      "unregistered sentinel",
+			err:       statusErr(codes.Unknown, errors.Wrap(errOther, "very wrap")),
+			expStatus: http.StatusInternalServerError,
+			expBody:   `{"code":"ERR_12345","message":"such test"}`,
+		},
+		{
+			name:      "fudge error",
+			err:       statusErr(codes.Unknown, errors.New("such test")),
+			expStatus: http.StatusInternalServerError,
+			expBody:   `{"message":"Internal Server Error"}`,
+		},
+		{
+			name:      "grpc code",
+			err:       statusErr(codes.DeadlineExceeded, errors.Wrap(context.DeadlineExceeded, "")),
+			expStatus: http.StatusGatewayTimeout,
+			expBody:   `{"message":"Gateway Timeout"}`,
+		},
+		{
+			name:      "grpc error",
+			err:       status.Error(codes.PermissionDenied, "nope"),
+			expStatus: http.StatusForbidden,
+			expBody:   `{"message":"Forbidden"}`,
+		},
+		{
+			name:      "client intercepted",
+			err:       errors.NewWithCause("rpc error", errors.Wrap(errNotFound, "")),
+			expStatus: http.StatusNotFound,
+			expBody:   `{"code":"ERR_f2a2c5b0c3e1d4a7","message":"razor not found"}`,
+		},
+		{
+			name:      "routing error",
+			err:       &runtime.HTTPStatusError{HTTPStatus: http.StatusMethodNotAllowed, Err: status.Error(codes.Unimplemented, "nope")},
+			expStatus: http.StatusMethodNotAllowed,
+			expBody:   `{"message":"Method Not Allowed"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			h := gateway.NewErrorHandler(tt.opts...)
+			h(context.Background(), runtime.NewServeMux(), &runtime.JSONPb{}, w, r, tt.err)
+
+			require.Equal(t, tt.expStatus, w.Code)
+			require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			require.JSONEq(t, tt.expBody, w.Body.String())
+		})
+	}
+}
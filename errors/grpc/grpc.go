@@ -21,7 +21,7 @@ func UnaryServerInterceptor(ctx context.Context, req any,
 	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
 
 	resp, err := handler(ctx, req)
-	return resp, interceptServer(err)
+	return resp, interceptServer(ctx, info.FullMethod, err)
 }
 
 func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc,
@@ -29,7 +29,7 @@ func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc,
 	opts ...grpc.CallOption) (grpc.ClientStream, error) {
 
 	cs, err := streamer(ctx, desc, cc, method, opts...)
-	return &clientStream{ClientStream: cs}, interceptServer(err)
+	return &clientStream{ClientStream: cs}, interceptClient(err)
 }
 
 type clientStream struct {
@@ -47,5 +47,5 @@ func (s *clientStream) RecvMsg(m any) error {
 func StreamServerInterceptor(srv any, ss grpc.ServerStream,
 	info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 
-	return interceptServer(handler(srv, ss))
+	return interceptServer(ss.Context(), info.FullMethod, handler(srv, ss))
 }
@@ -10,16 +10,25 @@ import (
 	"testing"
 
 	"github.com/rossmacarthur/fudge/errors"
+	errorscodes "github.com/rossmacarthur/fudge/errors/codes"
 	errorsgrpc "github.com/rossmacarthur/fudge/errors/grpc"
 
 	"github.com/rossmacarthur/fudge/internal/grpctest"
 	"github.com/rossmacarthur/fudge/internal/grpctest/pb"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var errSentinel = errors.Sentinel("such test", "ERR_12345")
 
+var errNotFound = errors.Sentinel("such missing", "ERR_67890")
+
+func init() {
+	errorscodes.Register(errNotFound, errorscodes.NotFound)
+}
+
 func TestInterceptors(t *testing.T) {
 	ctx := context.Background()
 
@@ -168,6 +177,36 @@ func TestInterceptors(t *testing.T) {
 				require.Equal(t, "rpc error: rpc error: such test", err.Error())
 			},
 		},
+		{
+			name: "unary: with interceptor: hop metadata",
+			errFn: func() error {
+				return errors.New("such test")
+			},
+			expFn: func(t *testing.T, client *grpctest.Client) {
+				err := client.Buy(ctx, 1)
+				require.Nil(t, err.(*errors.Error).Metadata)
+
+				for i := 0; i < 2; i++ {
+					err = err.(*errors.Error).Cause
+					md := err.(*errors.Error).Metadata
+					require.Equal(t, "/candystore.CandyStore/Buy", md.Method)
+					require.NotEmpty(t, md.Peer)
+					require.False(t, md.Time.IsZero())
+				}
+			},
+		},
+		{
+			name:              "unary: with interceptor: registered code",
+			noClientIntercept: true,
+			errFn: func() error {
+				return errors.Wrap(errNotFound, "very wrap")
+			},
+			expFn: func(t *testing.T, client *grpctest.Client) {
+				err := client.Buy(ctx, 0)
+				require.Equal(t, codes.NotFound, status.Code(err))
+				require.Equal(t, "rpc error: code = NotFound desc = very wrap: such missing (ERR_67890)", err.Error())
+			},
+		},
 		{
 			name:     "unary: with interceptor: no server",
 			noServer: true,
@@ -284,6 +323,19 @@ func TestInterceptors(t *testing.T) {
 				require.Equal(t, "rpc error: such test", err.Error())
 			},
 		},
+		{
+			name: "unary: with interceptor: format hops",
+			errFn: func() error {
+				return errors.New("such test")
+			},
+			expFn: func(t *testing.T, client *grpctest.Client) {
+				err := client.Buy(ctx, 0)
+				s := fmt.Sprintf("%+v", err)
+				require.Regexp(t, `^rpc error: such test\n`, s)
+				require.Regexp(t, `\n\ncaused by: such test\nhop: method=/candystore.CandyStore/Buy peer=\S+ time=\S+`, s)
+				require.Regexp(t, `\ngithub.com/rossmacarthur/fudge/errors/grpc/grpc_test.go:\d+ TestInterceptors.func\d+\n`, s)
+			},
+		},
 		{
 			name: "stream to: fudge sentinel error",
 			errFn: func() error {
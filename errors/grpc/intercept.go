@@ -4,8 +4,10 @@ import (
 	"context"
 
 	"github.com/rossmacarthur/fudge/errors"
+	errorscodes "github.com/rossmacarthur/fudge/errors/codes"
 	"github.com/rossmacarthur/fudge/internal/fudgepb"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
@@ -25,17 +27,23 @@ func interceptClient(err error) error {
 }
 
 // interceptServer converts the error into an error that implements GRPCStatus.
-// Any Fudge error information is encoded in the gRPC status details.
-func interceptServer(err error) error {
+// Any Fudge error information is encoded in the gRPC status details along with
+// the metadata for this hop.
+func interceptServer(ctx context.Context, method string, err error) error {
 	if err == nil {
 		return nil
 	}
-	return &grpcError{err: err}
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	return &grpcError{err: err, md: fudgepb.NewMetadata(method, addr)}
 }
 
 // grpcError wraps an error and implements the GRPCStatus interface.
 type grpcError struct {
 	err error
+	md  *errors.Metadata
 }
 
 // Error implements the error interface
@@ -47,15 +55,8 @@ func (e *grpcError) Error() string {
 // gRPC status. Fudge errors are converted into a protobuf representation and
 // stored in the details.
 func (e *grpcError) GRPCStatus() *status.Status {
-	code := codes.Unknown
-	if errors.Is(e.err, context.Canceled) {
-		code = codes.Canceled
-	} else if errors.Is(e.err, context.DeadlineExceeded) {
-		code = codes.DeadlineExceeded
-	}
-
-	s := status.New(code, e.err.Error())
-	sw, err := s.WithDetails(fudgepb.ToProto(e.err))
+	s := status.New(codes.Code(errorscodes.Of(e.err)), e.err.Error())
+	sw, err := s.WithDetails(fudgepb.ToProtoWithMetadata(e.err, e.md))
 	if err != nil {
 		// TODO: Log in this case?
 		return s
@@ -64,9 +65,26 @@ func (e *grpcError) GRPCStatus() *status.Status {
 	return sw
 }
 
+// Limits bounds the size of the Fudge information decoded from the details.
+type Limits = fudgepb.Limits
+
+// DefaultLimits returns the limits used by FromStatus and the client
+// interceptors. The result is a copy so changing it has no effect on them,
+// instead pass it to FromStatusWithLimits.
+func DefaultLimits() Limits {
+	return fudgepb.DefaultLimits
+}
+
 // FromStatus converts a gRPC status into an error by extracting any Fudge
 // information from the details.
 func FromStatus(s *status.Status) error {
+	return FromStatusWithLimits(s, fudgepb.DefaultLimits)
+}
+
+// FromStatusWithLimits is like FromStatus but the Fudge information is
+// validated against the given limits. If the information is invalid then the
+// readable parts are still returned.
+func FromStatusWithLimits(s *status.Status, l Limits) error {
 	if s.Code() == codes.OK {
 		return nil
 	}
@@ -77,7 +95,7 @@ func FromStatus(s *status.Status) error {
 			continue
 		}
 		// NB: Don't wrap because we want to start a new hop.
-		return errors.NewWithCause("rpc error", fudgepb.FromProto(pb))
+		return errors.NewWithCause("rpc error", fudgepb.FromProtoWithLimits(pb, l))
 	}
 
 	return errors.Wrap(s.Err(), "")
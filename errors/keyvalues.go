@@ -1,31 +1,205 @@
 package errors
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"sort"
+	"strings"
+	"sync"
 )
 
-type KeyValues map[string]string
+// KeyValue is a single key value pair
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// KeyValues is a list of key value pairs in insertion order.
+//
+// The keys of the key values of a single frame are unique. The merged key
+// values of multiple frames, see MergeKeyValues, can contain the same key more
+// than once.
+type KeyValues []KeyValue
 
 func (m *KeyValues) clone() KeyValues {
 	clone := make(KeyValues, len(*m))
-	for k, v := range *m {
-		clone[k] = v
-	}
+	copy(clone, *m)
 	return clone
 }
 
+// Get returns the last value for the key
+func (m KeyValues) Get(key string) (string, bool) {
+	for i := len(m) - 1; i >= 0; i-- {
+		if m[i].Key == key {
+			return m[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// set replaces the value of the key if it exists otherwise it appends it
+func (m *KeyValues) set(key, value string) {
+	for i, kv := range *m {
+		if kv.Key == key {
+			(*m)[i].Value = value
+			return
+		}
+	}
+	*m = append(*m, KeyValue{Key: key, Value: value})
+}
+
+// keyValueGroup is all the values for a key
+type keyValueGroup struct {
+	key    string
+	values []string
+}
+
+// value returns the value, or if there are multiple values then all of them
+// in a list, e.g. [1 2]
+func (g keyValueGroup) value() string {
+	if len(g.values) == 1 {
+		return g.values[0]
+	}
+	return "[" + strings.Join(g.values, " ") + "]"
+}
+
+// groups returns the values grouped by key in the order each key first
+// appears
+func (m KeyValues) groups() []keyValueGroup {
+	var groups []keyValueGroup
+	index := make(map[string]int, len(m))
+	for _, kv := range m {
+		i, ok := index[kv.Key]
+		if !ok {
+			i = len(groups)
+			index[kv.Key] = i
+			groups = append(groups, keyValueGroup{key: kv.Key})
+		}
+		groups[i].values = append(groups[i].values, kv.Value)
+	}
+	return groups
+}
+
+// Format implements the fmt.Formatter interface
+//
+// Keys with multiple values are printed once with all the values, e.g.
+// id:[1 2].
 func (m KeyValues) Format(s fmt.State, verb rune) {
-	var keys []string
-	for k := range m {
-		keys = append(keys, k)
+	for i, g := range m.groups() {
+		if i > 0 {
+			fmt.Fprint(s, ", ")
+		}
+		fmt.Fprintf(s, "%s:%s", g.key, g.value())
 	}
-	sort.Strings(keys)
-	for i, k := range keys {
+}
+
+// MarshalJSON implements the json.Marshaler interface
+//
+// The key values are encoded as an object in insertion order. Keys with
+// multiple values have an array of all the values.
+func (m KeyValues) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, g := range m.groups() {
 		if i > 0 {
-			fmt.Fprintf(s, ", %s:%s", k, m[k])
-		} else {
-			fmt.Fprintf(s, "%s:%s", k, m[k])
+			buf.WriteByte(',')
+		}
+		var value any = g.values
+		if len(g.values) == 1 {
+			value = g.values[0]
+		}
+		k, err := json.Marshal(g.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// KeyValuePolicy determines how key values with the same key at different
+// depths are merged, see MergeKeyValues.
+type KeyValuePolicy int
+
+const (
+	// KeepAllValues keeps every value, they are printed together, e.g.
+	// id:[1 2]
+	KeepAllValues KeyValuePolicy = iota
+	// FirstValueWins keeps only the first value, i.e. the innermost one
+	FirstValueWins
+	// LastValueWins keeps only the last value, i.e. the outermost one
+	LastValueWins
+	// NamespaceByDepth prefixes each key that appears at more than one depth
+	// with the depth, e.g. 0.id:1, 2.id:2
+	NamespaceByDepth
+)
+
+// keyValuePolicy is the process-wide policy used to merge key values
+var keyValuePolicy = struct {
+	sync.RWMutex
+	p KeyValuePolicy
+}{}
+
+// SetKeyValuePolicy sets the policy used to merge key values with the same
+// key, the default is KeepAllValues.
+//
+// This function is intended to be called once at program startup.
+func SetKeyValuePolicy(p KeyValuePolicy) {
+	keyValuePolicy.Lock()
+	defer keyValuePolicy.Unlock()
+
+	keyValuePolicy.p = p
+}
+
+// MergeKeyValues merges the key values of multiple depths, e.g. the frames of
+// a stack trace from the innermost to the outermost, into a single list using
+// the current KeyValuePolicy. The depth of the key values is their index.
+func MergeKeyValues(depths ...KeyValues) KeyValues {
+	keyValuePolicy.RLock()
+	p := keyValuePolicy.p
+	keyValuePolicy.RUnlock()
+
+	var merged KeyValues
+	for _, kvs := range depths {
+		merged = append(merged, kvs...)
+	}
+
+	switch p {
+	case FirstValueWins, LastValueWins:
+		var kvs KeyValues
+		for _, kv := range merged {
+			if _, ok := kvs.Get(kv.Key); ok && p == FirstValueWins {
+				continue
+			}
+			kvs.set(kv.Key, kv.Value)
+		}
+		return kvs
+
+	case NamespaceByDepth:
+		count := make(map[string]int)
+		for _, kvs := range depths {
+			for _, kv := range kvs {
+				count[kv.Key]++
+			}
 		}
+		var kvs KeyValues
+		for depth, d := range depths {
+			for _, kv := range d {
+				if count[kv.Key] > 1 {
+					kv.Key = fmt.Sprintf("%d.%s", depth, kv.Key)
+				}
+				kvs = append(kvs, kv)
+			}
+		}
+		return kvs
 	}
+
+	return merged
 }
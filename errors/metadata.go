@@ -0,0 +1,51 @@
+package errors
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metadata is information about the process and RPC call in which an error
+// occurred. It is recorded by the RPC server interceptors for each hop.
+type Metadata struct {
+	// Method is the full RPC method name (can be empty)
+	Method string
+	// Peer is the address of the peer that made the RPC call (can be empty)
+	Peer string
+	// Time is the time the error was returned by the server (can be zero)
+	Time time.Time
+	// Version is the main module version of the binary (can be empty)
+	Version string
+	// Revision is the VCS revision the binary was built from (can be empty)
+	Revision string
+}
+
+func (m *Metadata) clone() *Metadata {
+	c := *m
+	return &c
+}
+
+func (m *Metadata) isEmpty() bool {
+	return m == nil || *m == Metadata{}
+}
+
+// Format implements the fmt.Formatter interface
+//
+// Only fields that are set are printed.
+func (m Metadata) Format(s fmt.State, verb rune) {
+	var sep string
+	write := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(s, "%s%s=%s", sep, k, v)
+			sep = " "
+		}
+	}
+
+	write("method", m.Method)
+	write("peer", m.Peer)
+	if !m.Time.IsZero() {
+		write("time", m.Time.UTC().Format(time.RFC3339Nano))
+	}
+	write("version", m.Version)
+	write("revision", m.Revision)
+}
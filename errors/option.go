@@ -8,10 +8,7 @@ type takesOption struct {
 
 // SetKeyValue implements the fudge.apply interface
 func (e *takesOption) SetKeyValue(k, v string) {
-	if e.frame.KeyValues == nil {
-		e.frame.KeyValues = make(KeyValues)
-	}
-	e.frame.KeyValues[k] = v
+	e.frame.KeyValues.set(k, v)
 }
 
 func applyOptions(f *Frame, opts []fudge.Option) {
@@ -0,0 +1,90 @@
+package errors
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+
+	"github.com/rossmacarthur/fudge/internal/stack"
+)
+
+// PanicFormatter prints the stack traces in the same format as
+// runtime/debug.Stack so that existing tools such as panicparse can consume
+// them. Each hop is printed as a goroutine numbered by its position in the
+// error with the binary as the state. For example:
+//
+//	failed to shave yak: razor not found
+//
+//	goroutine 1 [example]:
+//	main.locateRazor(...)
+//		/home/gopher/example/main.go:20
+//	main.main(...)
+//		/home/gopher/example/main.go:13
+//
+// Functions are named like the runtime names them, e.g. main.main.func2.1.
+// Absolute paths and program counter offsets are used where known, i.e. for
+// frames captured by this process if it was not built with -trimpath. The
+// width is ignored.
+var PanicFormatter Formatter = FormatterFunc(formatPanic)
+
+func formatPanic(s fmt.State, _ rune, e *Error) {
+	io.WriteString(s, e.fullMessage())
+	if s.Flag('#') {
+		kvs := e.fullKeyValues()
+		if len(kvs) > 0 {
+			fmt.Fprintf(s, " {%v}", kvs)
+		}
+	}
+	if !s.Flag('+') && !s.Flag('#') {
+		return
+	}
+
+	for i, hop := range e.hops() {
+		if len(hop.Trace) == 0 {
+			continue
+		}
+		state := hop.Binary
+		if state == "" {
+			state = "running"
+		}
+		fmt.Fprintf(s, "\n\ngoroutine %d [%s]:", i+1, state)
+		// NB: Source information is only available for hops in this binary,
+		// hops decoded from the wire always have metadata.
+		local := hop.Metadata == nil
+		for _, f := range limitFrames(s, hop.Trace) {
+			if f.elided() {
+				io.WriteString(s, "\n"+f.Function)
+				continue
+			}
+			file, function := panicFrame(f, local)
+			fmt.Fprintf(s, "\n%s(...)\n\t%s:%d", function, file, f.Line)
+			// NB: The program counter is only meaningful in this binary and
+			// inlined functions have no offset of their own.
+			if fn := runtime.FuncForPC(f.PC); fn != nil && local && !f.Inlined {
+				fmt.Fprintf(s, " +%#x", f.PC-fn.Entry())
+			}
+		}
+	}
+}
+
+// panicFrame returns the absolute file path, if known, and the package
+// qualified runtime function name of the frame, e.g. main.main.func2.1. If the
+// package is not known then it is assumed to be the directory of the file.
+func panicFrame(f Frame, local bool) (string, string) {
+	function := stack.RuntimeName(f.Function)
+	if src, ok := stack.Lookup(f.File); ok && local {
+		file := f.File
+		if src.Path != "" {
+			file = src.Path
+		}
+		return file, src.Package + "." + function
+	}
+	if f.Package != "" {
+		return f.File, f.Package + "." + function
+	}
+	if dir := path.Dir(f.File); dir != "." {
+		return f.File, dir + "." + function
+	}
+	return f.File, function
+}
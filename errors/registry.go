@@ -0,0 +1,102 @@
+package errors
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// registry is the table of non-Fudge sentinel errors that can be passed over
+// the wire, in registration order.
+var registry = struct {
+	sync.RWMutex
+	codes []string
+	errs  map[string]error
+}{
+	errs: make(map[string]error),
+}
+
+// NB: Only the sentinels of packages that this package already depends on are
+// registered by default, see the stdsentinels package for the others.
+func init() {
+	for _, s := range []struct {
+		code string
+		err  error
+	}{
+		{"context.Canceled", context.Canceled},
+		{"context.DeadlineExceeded", context.DeadlineExceeded},
+		{"io.EOF", io.EOF},
+		{"io.ErrUnexpectedEOF", io.ErrUnexpectedEOF},
+		{"io.ErrClosedPipe", io.ErrClosedPipe},
+		{"io.ErrNoProgress", io.ErrNoProgress},
+		{"io.ErrShortBuffer", io.ErrShortBuffer},
+		{"io.ErrShortWrite", io.ErrShortWrite},
+		{"fs.ErrInvalid", fs.ErrInvalid},
+		{"fs.ErrPermission", fs.ErrPermission},
+		{"fs.ErrExist", fs.ErrExist},
+		{"fs.ErrNotExist", fs.ErrNotExist},
+		{"fs.ErrClosed", fs.ErrClosed},
+		{"os.ErrNoDeadline", os.ErrNoDeadline},
+		{"os.ErrDeadlineExceeded", os.ErrDeadlineExceeded},
+		{"os.ErrProcessDone", os.ErrProcessDone},
+	} {
+		RegisterSentinel(s.code, s.err)
+	}
+}
+
+// RegisterSentinel registers a non-Fudge sentinel error with a stable code.
+//
+// Registered sentinels can be compared using Is even after being passed over
+// the wire (if the provided gRPC interceptors are used). Well-known standard
+// library sentinels such as io.EOF and fs.ErrNotExist are registered by
+// default, import the stdsentinels package to register the net and
+// database/sql sentinels. The code should be unique and stable across
+// releases, it is recommended to use the package qualified name, e.g.
+// "pgx.ErrNoRows".
+//
+// This function is intended to be called from an init function. It panics if
+// the code is empty, already registered or if the error is nil.
+func RegisterSentinel(code string, err error) {
+	if code == "" {
+		panic("fudge/errors: sentinel code must not be empty")
+	}
+	if err == nil {
+		panic("fudge/errors: sentinel error must not be nil")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.errs[code]; ok {
+		panic("fudge/errors: sentinel code " + code + " already registered")
+	}
+	registry.codes = append(registry.codes, code)
+	registry.errs[code] = err
+}
+
+// LookupSentinel returns the registered non-Fudge sentinel error with the
+// given code.
+func LookupSentinel(code string) (error, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	err, ok := registry.errs[code]
+	return err, ok
+}
+
+// SentinelCode returns the code of the first registered non-Fudge sentinel
+// error that the error matches using Is. Sentinels are checked in
+// registration order.
+func SentinelCode(err error) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, code := range registry.codes {
+		if Is(err, registry.errs[code]) {
+			return code, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,186 @@
+package errors
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rossmacarthur/fudge/internal/stack"
+)
+
+// SourceFormatter is a Formatter for local development that prints the same
+// layout as the MultilineFormatter with the source code around each frame.
+// The line of the frame is marked with a caret. For example:
+//
+//	example/main.go:20 locateRazor
+//	   19 | func locateRazor() error {
+//	   20 | 	return errors.Wrap(ErrRazorNotFound, "")
+//	      | 	^
+//	   21 | }
+//
+// The source is only printed for frames captured by this binary, outside of
+// the standard library and when the source file is available, e.g. it is not
+// available for remote hops or binaries built with -trimpath. The elided type
+// arguments of generic functions are filled in with the type parameter names
+// from the source file, e.g. Map[...] is printed as Map[K, V].
+type SourceFormatter struct {
+	// Lines is the number of lines of source code to print before and after
+	// each frame, if zero then two lines are printed
+	Lines int
+}
+
+// FormatError implements the Formatter interface
+func (f *SourceFormatter) FormatError(s fmt.State, _ rune, e *Error) {
+	lines := f.Lines
+	if lines <= 0 {
+		lines = 2
+	}
+	hopLayout{source: lines}.format(s, e)
+}
+
+// source is the source code around a frame
+type source struct {
+	// start is the line number of the first line
+	start int
+	// line is the line number of the frame
+	line  int
+	lines []string
+}
+
+// readSource reads the source code around the frame. It returns false if the
+// frame is in the standard library or the source is not available.
+func readSource(f Frame, n int) (*source, bool) {
+	if f.Line <= 0 {
+		return nil, false
+	}
+	src, ok := stack.Lookup(f.File)
+	if !ok || src.Path == "" || src.Std {
+		return nil, false
+	}
+	bs, err := os.ReadFile(src.Path)
+	if err != nil {
+		return nil, false
+	}
+
+	lines := strings.Split(string(bytes.ReplaceAll(bs, []byte("\r\n"), []byte("\n"))), "\n")
+	if f.Line > len(lines) {
+		return nil, false
+	}
+	start := max(f.Line-n, 1)
+	end := min(f.Line+n, len(lines))
+	return &source{start: start, line: f.Line, lines: lines[start-1 : end]}, true
+}
+
+// format prints each line with a line number, and a caret below the line of
+// the frame pointing at the first non-whitespace character
+func (src *source) format(w io.Writer, prefix string, p palette) {
+	width := len(strconv.Itoa(src.start + len(src.lines) - 1))
+	for i, line := range src.lines {
+		n := src.start + i
+		gutter := p.paint(p.library, fmt.Sprintf("%*d |", width, n))
+		if line == "" {
+			fmt.Fprintf(w, "\n%s%s", prefix, gutter)
+		} else {
+			fmt.Fprintf(w, "\n%s%s %s", prefix, gutter, line)
+		}
+		if n == src.line {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			gutter := p.paint(p.library, fmt.Sprintf("%*s |", width, ""))
+			fmt.Fprintf(w, "\n%s%s %s%s", prefix, gutter, indent, p.paint(p.caret, "^"))
+		}
+	}
+}
+
+// fillTypeParams replaces the elided type arguments in the function name of
+// the frame, e.g. Map[...] or (*Server[...]).Buy, with the type parameter
+// names of the generic declaration in the source file. Go doesn't record the
+// type arguments of an instantiation so the names are the best that can be
+// done. The name is returned unchanged if the source is not available.
+func fillTypeParams(f Frame, function string) string {
+	i := strings.Index(function, "[...]")
+	if i == -1 {
+		return function
+	}
+	src, ok := stack.Lookup(f.File)
+	if !ok || src.Path == "" || src.Std {
+		return function
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), src.Path, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return function
+	}
+
+	// NB: Only the function or receiver type can be generic, methods and
+	// closures can't have their own type parameters.
+	name := function[strings.LastIndex(function[:i], ".")+1 : i]
+	name = strings.TrimLeft(name, "(*")
+	var method string
+	if f.Receiver != "" {
+		rest := strings.TrimPrefix(function[i+len("[...]"):], ")")
+		method, _, _ = strings.Cut(strings.TrimPrefix(rest, "."), ".")
+	}
+
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		var params []string
+		if method != "" {
+			if fd.Recv == nil || len(fd.Recv.List) != 1 || fd.Name.Name != method {
+				continue
+			}
+			var recv string
+			recv, params = receiverParams(fd.Recv.List[0].Type)
+			if recv != name {
+				continue
+			}
+		} else {
+			if fd.Recv != nil || fd.Name.Name != name || fd.Type.TypeParams == nil {
+				continue
+			}
+			for _, field := range fd.Type.TypeParams.List {
+				for _, n := range field.Names {
+					params = append(params, n.Name)
+				}
+			}
+		}
+		if len(params) == 0 {
+			return function
+		}
+		return function[:i] + "[" + strings.Join(params, ", ") + "]" + function[i+len("[...]"):]
+	}
+	return function
+}
+
+// receiverParams returns the type name and type parameter names of a method
+// receiver, e.g. *Server[T]
+func receiverParams(expr ast.Expr) (string, []string) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	var indices []ast.Expr
+	switch x := expr.(type) {
+	case *ast.IndexExpr:
+		expr, indices = x.X, []ast.Expr{x.Index}
+	case *ast.IndexListExpr:
+		expr, indices = x.X, x.Indices
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return "", nil
+	}
+	var names []string
+	for _, index := range indices {
+		if id, ok := index.(*ast.Ident); ok {
+			names = append(names, id.Name)
+		}
+	}
+	return ident.Name, names
+}
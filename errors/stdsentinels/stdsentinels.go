@@ -0,0 +1,28 @@
+// Package stdsentinels registers the sentinel errors of the net and
+// database/sql packages so that they can be compared using Is after being
+// passed over the wire. They are not registered by the errors package so that
+// it doesn't depend on those packages. Import it for its side effects:
+//
+//	import _ "github.com/rossmacarthur/fudge/errors/stdsentinels"
+package stdsentinels
+
+import (
+	"database/sql"
+	"net"
+
+	"github.com/rossmacarthur/fudge/errors"
+)
+
+func init() {
+	for _, s := range []struct {
+		code string
+		err  error
+	}{
+		{"net.ErrClosed", net.ErrClosed},
+		{"sql.ErrNoRows", sql.ErrNoRows},
+		{"sql.ErrConnDone", sql.ErrConnDone},
+		{"sql.ErrTxDone", sql.ErrTxDone},
+	} {
+		errors.RegisterSentinel(s.code, s.err)
+	}
+}
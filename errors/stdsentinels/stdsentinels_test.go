@@ -0,0 +1,28 @@
+package stdsentinels_test
+
+import (
+	"database/sql"
+	"net"
+	"testing"
+
+	"github.com/rossmacarthur/fudge/errors"
+	_ "github.com/rossmacarthur/fudge/errors/stdsentinels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistered(t *testing.T) {
+	for code, target := range map[string]error{
+		"net.ErrClosed":   net.ErrClosed,
+		"sql.ErrNoRows":   sql.ErrNoRows,
+		"sql.ErrConnDone": sql.ErrConnDone,
+		"sql.ErrTxDone":   sql.ErrTxDone,
+	} {
+		err, ok := errors.LookupSentinel(code)
+		require.True(t, ok, code)
+		require.Equal(t, target, err)
+
+		got, ok := errors.SentinelCode(errors.Wrap(target, "very wrap"))
+		require.True(t, ok, code)
+		require.Equal(t, code, got)
+	}
+}
@@ -1,6 +1,9 @@
 package fudge
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type Option interface {
 	Apply(apply)
@@ -25,10 +28,15 @@ func KV(k string, x any) Option {
 
 type MKV map[string]any
 
+// Apply sets the key values in sorted key order since maps are unordered
 func (o MKV) Apply(a apply) {
-	for k, x := range o {
-		v := fmt.Sprint(x)
-		a.SetKeyValue(k, v)
+	keys := make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		a.SetKeyValue(k, fmt.Sprint(o[k]))
 	}
 }
 
@@ -0,0 +1,517 @@
+// Package fudgevet defines an Analyzer that reports misuse of Fudge errors.
+//
+// The analyzer can be run using the fudgevet command directly or through go
+// vet.
+//
+//	go install github.com/rossmacarthur/fudge/cmd/fudgevet
+//	go vet -vettool=$(which fudgevet) ./...
+package fudgevet
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/rossmacarthur/fudge/internal/verbs"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const (
+	fudgePath  = "github.com/rossmacarthur/fudge"
+	errorsPath = "github.com/rossmacarthur/fudge/errors"
+)
+
+const doc = `report misuse of Fudge errors
+
+The fudgevet analyzer reports
+  - calls to errors.New with options at package scope, which panic at init
+  - calls to errors.Wrap whose result is discarded
+  - calls to fmt.Errorf that format a Fudge error without %w, which loses the
+    stack trace
+  - sentinel errors returned without errors.Wrap, which have no stack trace
+  - calls to fmt.Sprintf in error messages instead of using fudge.KV`
+
+// Analyzer reports misuse of Fudge errors.
+var Analyzer = &analysis.Analyzer{
+	Name:      "fudgevet",
+	Doc:       doc,
+	Run:       run,
+	FactTypes: []analysis.Fact{new(isSentinel)},
+}
+
+// isSentinel is a fact recorded for package level variables that are declared
+// using errors.Sentinel. Facts are shared between packages so sentinel errors
+// from other packages are also detected.
+type isSentinel struct{}
+
+func (*isSentinel) AFact() {}
+
+func (*isSentinel) String() string {
+	return "sentinel"
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	// NB: Sentinel errors need to be found before any returns are checked.
+	for _, f := range pass.Files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				checkGlobal(pass, spec.(*ast.ValueSpec))
+			}
+		}
+	}
+
+	vars := fudgeVars(pass)
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.ExprStmt:
+				checkDiscarded(pass, n)
+			case *ast.ReturnStmt:
+				checkReturn(pass, f, n)
+			case *ast.CallExpr:
+				checkErrorf(pass, vars, n)
+				checkSprintf(pass, f, n)
+			}
+			return true
+		})
+	}
+
+	return nil, nil
+}
+
+// checkGlobal records sentinel errors declared in the value spec and reports
+// calls to errors.New with options that are evaluated at package scope.
+func checkGlobal(pass *analysis.Pass, spec *ast.ValueSpec) {
+	for i, v := range spec.Values {
+		call, ok := astutil.Unparen(v).(*ast.CallExpr)
+		if ok && isFunc(pass.TypesInfo, call, errorsPath, "Sentinel") && len(spec.Names) == len(spec.Values) {
+			if obj := pass.TypesInfo.Defs[spec.Names[i]]; obj != nil {
+				pass.ExportObjectFact(obj, new(isSentinel))
+			}
+		}
+
+		ast.Inspect(v, func(n ast.Node) bool {
+			// NB: Function literals are not called at package scope.
+			if _, ok := n.(*ast.FuncLit); ok {
+				return false
+			}
+			call, ok := n.(*ast.CallExpr)
+			if !ok || !isFunc(pass.TypesInfo, call, errorsPath, "New") || len(call.Args) < 2 {
+				return true
+			}
+			end := call.Args[len(call.Args)-1].End()
+			if call.Ellipsis.IsValid() {
+				end = call.Ellipsis + token.Pos(len("..."))
+			}
+			pass.Report(analysis.Diagnostic{
+				Pos:     call.Pos(),
+				End:     call.End(),
+				Message: "errors.New with options at package scope panics at init",
+				SuggestedFixes: []analysis.SuggestedFix{{
+					Message: "Remove the options",
+					TextEdits: []analysis.TextEdit{{
+						Pos: call.Args[0].End(),
+						End: end,
+					}},
+				}},
+			})
+			return true
+		})
+	}
+}
+
+// checkDiscarded reports calls to errors.Wrap whose result is not used.
+func checkDiscarded(pass *analysis.Pass, stmt *ast.ExprStmt) {
+	call, ok := astutil.Unparen(stmt.X).(*ast.CallExpr)
+	if !ok || !isFunc(pass.TypesInfo, call, errorsPath, "Wrap") {
+		return
+	}
+
+	d := analysis.Diagnostic{
+		Pos:     call.Pos(),
+		End:     call.End(),
+		Message: "result of errors.Wrap is discarded",
+	}
+	if len(call.Args) > 0 {
+		if id, ok := astutil.Unparen(call.Args[0]).(*ast.Ident); ok && id.Name != "_" {
+			if _, ok := pass.TypesInfo.Uses[id].(*types.Var); ok {
+				d.SuggestedFixes = []analysis.SuggestedFix{{
+					Message: fmt.Sprintf("Assign the result to %s", id.Name),
+					TextEdits: []analysis.TextEdit{{
+						Pos:     call.Pos(),
+						End:     call.Pos(),
+						NewText: []byte(id.Name + " = "),
+					}},
+				}}
+			}
+		}
+	}
+	pass.Report(d)
+}
+
+// checkErrorf reports calls to fmt.Errorf that format Fudge errors using a
+// verb other than %w.
+func checkErrorf(pass *analysis.Pass, vars map[*types.Var]bool, call *ast.CallExpr) {
+	if !isFunc(pass.TypesInfo, call, "fmt", "Errorf") || len(call.Args) < 2 {
+		return
+	}
+	format, ok := stringConst(pass.TypesInfo, call.Args[0])
+	if !ok {
+		return
+	}
+	vs, ok := verbs.Parse(format)
+	if !ok {
+		return
+	}
+
+	// The offsets of the verbs are only known if the format is a literal
+	// without any escape sequences.
+	lit, _ := astutil.Unparen(call.Args[0]).(*ast.BasicLit)
+	plain := lit != nil && lit.Value[1:len(lit.Value)-1] == format
+
+	for i, v := range vs {
+		if i+1 >= len(call.Args) {
+			break
+		}
+		arg := call.Args[i+1]
+		if v.Verb == 'w' || !isFudgeError(pass, vars, arg) {
+			continue
+		}
+
+		d := analysis.Diagnostic{
+			Pos:     arg.Pos(),
+			End:     arg.End(),
+			Message: fmt.Sprintf("fmt.Errorf formats a Fudge error with %s which loses the stack trace", format[v.Start:v.End]),
+		}
+		if plain {
+			d.SuggestedFixes = []analysis.SuggestedFix{{
+				Message: "Use %w",
+				TextEdits: []analysis.TextEdit{{
+					Pos:     lit.Pos() + token.Pos(1+v.Start),
+					End:     lit.Pos() + token.Pos(1+v.End),
+					NewText: []byte("%w"),
+				}},
+			}}
+		}
+		pass.Report(d)
+	}
+}
+
+// checkReturn reports sentinel errors that are returned without wrapping.
+func checkReturn(pass *analysis.Pass, f *ast.File, ret *ast.ReturnStmt) {
+	for _, r := range ret.Results {
+		var id *ast.Ident
+		switch e := astutil.Unparen(r).(type) {
+		case *ast.Ident:
+			id = e
+		case *ast.SelectorExpr:
+			id = e.Sel
+		default:
+			continue
+		}
+		obj, ok := pass.TypesInfo.Uses[id].(*types.Var)
+		if !ok || !pass.ImportObjectFact(obj, new(isSentinel)) {
+			continue
+		}
+
+		d := analysis.Diagnostic{
+			Pos:     r.Pos(),
+			End:     r.End(),
+			Message: fmt.Sprintf("sentinel error %s is returned without errors.Wrap so it has no stack trace", id.Name),
+		}
+		if name, ok := importName(f, errorsPath); ok {
+			d.SuggestedFixes = []analysis.SuggestedFix{{
+				Message: "Wrap the error",
+				TextEdits: []analysis.TextEdit{
+					{Pos: r.Pos(), End: r.Pos(), NewText: []byte(qualify(name, "Wrap") + "(")},
+					{Pos: r.End(), End: r.End(), NewText: []byte(`, "")`)},
+				},
+			}}
+		}
+		pass.Report(d)
+	}
+}
+
+// checkSprintf reports calls to fmt.Sprintf used to build the message of a
+// Fudge error.
+func checkSprintf(pass *analysis.Pass, f *ast.File, call *ast.CallExpr) {
+	var msg ast.Expr
+	switch {
+	case isFunc(pass.TypesInfo, call, errorsPath, "Wrap") && len(call.Args) > 1:
+		msg = call.Args[1]
+	case isFunc(pass.TypesInfo, call, errorsPath, "New") && len(call.Args) > 0,
+		isFunc(pass.TypesInfo, call, errorsPath, "NewWithCause") && len(call.Args) > 0:
+		msg = call.Args[0]
+	default:
+		return
+	}
+	sprintf, ok := astutil.Unparen(msg).(*ast.CallExpr)
+	if !ok || !isFunc(pass.TypesInfo, sprintf, "fmt", "Sprintf") {
+		return
+	}
+
+	d := analysis.Diagnostic{
+		Pos:     sprintf.Pos(),
+		End:     sprintf.End(),
+		Message: "fmt.Sprintf in error message, use fudge.KV instead",
+	}
+	if edits, ok := sprintfEdits(pass, f, call, sprintf); ok {
+		d.SuggestedFixes = []analysis.SuggestedFix{{
+			Message:   "Use fudge.KV",
+			TextEdits: edits,
+		}}
+	}
+	pass.Report(d)
+}
+
+// sprintfEdits returns the edits that replace the call to fmt.Sprintf with
+// key values. This is only possible if every argument is a named value, which
+// is used as the key.
+func sprintfEdits(pass *analysis.Pass, f *ast.File, call, sprintf *ast.CallExpr) ([]analysis.TextEdit, bool) {
+	if call.Ellipsis.IsValid() || sprintf.Ellipsis.IsValid() || len(sprintf.Args) < 2 {
+		return nil, false
+	}
+	format, ok := stringConst(pass.TypesInfo, sprintf.Args[0])
+	if !ok {
+		return nil, false
+	}
+	vs, ok := verbs.Parse(format)
+	if !ok || len(vs) != len(sprintf.Args)-1 {
+		return nil, false
+	}
+
+	msg := verbs.Message(format, vs)
+
+	fudge, ok := importName(f, fudgePath)
+	var edits []analysis.TextEdit
+	if !ok {
+		edit, ok := addImport(f, fudgePath)
+		if !ok {
+			return nil, false
+		}
+		edits = append(edits, edit)
+		fudge = "fudge"
+	}
+
+	edits = append(edits, analysis.TextEdit{
+		Pos:     sprintf.Pos(),
+		End:     sprintf.End(),
+		NewText: []byte(strconv.Quote(msg)),
+	})
+
+	var kvs strings.Builder
+	for _, arg := range sprintf.Args[1:] {
+		var key string
+		switch e := astutil.Unparen(arg).(type) {
+		case *ast.Ident:
+			key = e.Name
+		case *ast.SelectorExpr:
+			key = e.Sel.Name
+		default:
+			return nil, false
+		}
+		fmt.Fprintf(&kvs, ", %s(%q, %s)", qualify(fudge, "KV"), key, render(pass.Fset, arg))
+	}
+	last := call.Args[len(call.Args)-1]
+	edits = append(edits, analysis.TextEdit{
+		Pos:     last.End(),
+		End:     last.End(),
+		NewText: []byte(kvs.String()),
+	})
+
+	return edits, true
+}
+
+// isFunc reports whether the call is to the named package level function.
+func isFunc(info *types.Info, call *ast.CallExpr, pkg, name string) bool {
+	var id *ast.Ident
+	switch fun := astutil.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return false
+	}
+	fn, ok := info.Uses[id].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Type().(*types.Signature).Recv() != nil {
+		return false
+	}
+	return fn.Pkg().Path() == pkg && fn.Name() == name
+}
+
+// isFudgeError reports whether the expression is a Fudge error. Since Fudge
+// errors are usually returned as plain errors, an error is only known to be
+// one if it is the result of an errors function, a sentinel error or one of
+// the given variables.
+func isFudgeError(pass *analysis.Pass, vars map[*types.Var]bool, e ast.Expr) bool {
+	if ptr, ok := pass.TypesInfo.TypeOf(e).(*types.Pointer); ok {
+		if named, ok := ptr.Elem().(*types.Named); ok {
+			obj := named.Obj()
+			return obj.Pkg() != nil && obj.Pkg().Path() == errorsPath && obj.Name() == "Error"
+		}
+	}
+
+	var id *ast.Ident
+	switch e := astutil.Unparen(e).(type) {
+	case *ast.CallExpr:
+		return isFudgeCall(pass.TypesInfo, e)
+	case *ast.Ident:
+		id = e
+	case *ast.SelectorExpr:
+		id = e.Sel
+	default:
+		return false
+	}
+	obj, ok := pass.TypesInfo.Uses[id].(*types.Var)
+	if !ok {
+		return false
+	}
+	return vars[obj] || pass.ImportObjectFact(obj, new(isSentinel))
+}
+
+// isFudgeCall reports whether the expression is a call to one of the errors
+// functions that return a Fudge error.
+func isFudgeCall(info *types.Info, e ast.Expr) bool {
+	call, ok := astutil.Unparen(e).(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	for _, name := range []string{"New", "NewWithCause", "Sentinel", "Wrap"} {
+		if isFunc(info, call, errorsPath, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fudgeVars returns the variables in the package that are declared with a
+// Fudge error and are only ever assigned Fudge errors. Variables whose address
+// is taken are excluded since they could be assigned anything.
+func fudgeVars(pass *analysis.Pass) map[*types.Var]bool {
+	good := make(map[*types.Var]bool)
+	bad := make(map[*types.Var]bool)
+	assign := func(id *ast.Ident, v ast.Expr) {
+		obj, ok := pass.TypesInfo.ObjectOf(id).(*types.Var)
+		if !ok {
+			return
+		}
+		if v == nil || !isFudgeCall(pass.TypesInfo, v) {
+			bad[obj] = true
+		} else if pass.TypesInfo.Defs[id] == obj {
+			good[obj] = true
+		}
+	}
+
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.ValueSpec:
+				for i, id := range n.Names {
+					var v ast.Expr
+					if len(n.Names) == len(n.Values) {
+						v = n.Values[i]
+					}
+					assign(id, v)
+				}
+			case *ast.AssignStmt:
+				for i, lhs := range n.Lhs {
+					id, ok := astutil.Unparen(lhs).(*ast.Ident)
+					if !ok {
+						continue
+					}
+					var v ast.Expr
+					if len(n.Lhs) == len(n.Rhs) && (n.Tok == token.ASSIGN || n.Tok == token.DEFINE) {
+						v = n.Rhs[i]
+					}
+					assign(id, v)
+				}
+			case *ast.UnaryExpr:
+				if id, ok := astutil.Unparen(n.X).(*ast.Ident); ok && n.Op == token.AND {
+					assign(id, nil)
+				}
+			}
+			return true
+		})
+	}
+
+	for obj := range bad {
+		delete(good, obj)
+	}
+	return good
+}
+
+func stringConst(info *types.Info, e ast.Expr) (string, bool) {
+	tv, ok := info.Types[e]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+// importName returns the name the package is imported as in the file. Dot
+// imports have an empty name.
+func importName(f *ast.File, path string) (string, bool) {
+	for _, spec := range f.Imports {
+		if p, _ := strconv.Unquote(spec.Path.Value); p != path {
+			continue
+		}
+		switch {
+		case spec.Name == nil:
+			return path[strings.LastIndex(path, "/")+1:], true
+		case spec.Name.Name == "_":
+			return "", false
+		case spec.Name.Name == ".":
+			return "", true
+		default:
+			return spec.Name.Name, true
+		}
+	}
+	return "", false
+}
+
+// addImport returns an edit that adds the import after the Fudge errors
+// import. This is only possible if it is in an import block.
+func addImport(f *ast.File, path string) (analysis.TextEdit, bool) {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT || !gd.Lparen.IsValid() {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if p, _ := strconv.Unquote(spec.Path.Value); p == errorsPath {
+				return analysis.TextEdit{
+					Pos:     spec.End(),
+					End:     spec.End(),
+					NewText: []byte("\n\t" + strconv.Quote(path)),
+				}, true
+			}
+		}
+	}
+	return analysis.TextEdit{}, false
+}
+
+func qualify(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+func render(fset *token.FileSet, e ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, e)
+	return buf.String()
+}
@@ -0,0 +1,12 @@
+package fudgevet_test
+
+import (
+	"testing"
+
+	"github.com/rossmacarthur/fudge/fudgevet"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), fudgevet.Analyzer, "a", "b")
+}
@@ -0,0 +1,57 @@
+package a
+
+import (
+	"fmt"
+
+	"github.com/rossmacarthur/fudge"
+	"github.com/rossmacarthur/fudge/errors"
+)
+
+var ErrSentinel = errors.Sentinel("such sentinel", "ERR_52fdfc072182654f") // want ErrSentinel:"sentinel"
+
+var errGlobal = errors.New("such global")
+
+var errOptions = errors.New("such global", fudge.KV("key", "value")) // want `errors.New with options at package scope panics at init`
+
+var errLazy = func() error {
+	return errors.New("such lazy", fudge.KV("key", "value"))
+}
+
+func discarded(err error) error {
+	errors.Wrap(err, "very wrap") // want `result of errors.Wrap is discarded`
+	return err
+}
+
+func errorf(err error, ferr *errors.Error, id int) error {
+	if id == 0 {
+		return fmt.Errorf("very wrap: %w", err)
+	}
+	if id == 1 {
+		return fmt.Errorf("very wrap %d: %v", id, err)
+	}
+	if id == 2 {
+		werr := errors.Wrap(err, "very wrap")
+		return fmt.Errorf("very wrap: %s", werr) // want `fmt.Errorf formats a Fudge error with %s which loses the stack trace`
+	}
+	if id == 3 {
+		return fmt.Errorf("very wrap: %v", errGlobal) // want `fmt.Errorf formats a Fudge error with %v which loses the stack trace`
+	}
+	return fmt.Errorf("very wrap: %+v", ferr) // want `fmt.Errorf formats a Fudge error with %\+v which loses the stack trace`
+}
+
+func sentinel(id int) (int, error) {
+	if id == 0 {
+		return 0, errors.Wrap(ErrSentinel, "")
+	}
+	if id == 1 {
+		return 0, errGlobal
+	}
+	return 0, ErrSentinel // want `sentinel error ErrSentinel is returned without errors.Wrap so it has no stack trace`
+}
+
+func sprintf(err error, user string, id int) error {
+	if id == 0 {
+		return errors.New(fmt.Sprintf("no user %s", user)) // want `fmt.Sprintf in error message, use fudge.KV instead`
+	}
+	return errors.Wrap(err, fmt.Sprintf("failed for user %s with id=%d", user, id), fudge.KV("a", "b")) // want `fmt.Sprintf in error message, use fudge.KV instead`
+}
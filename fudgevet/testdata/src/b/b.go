@@ -0,0 +1,21 @@
+package b
+
+import (
+	"fmt"
+
+	"a"
+
+	errs "github.com/rossmacarthur/fudge/errors"
+)
+
+func sentinel() error {
+	return a.ErrSentinel // want `sentinel error ErrSentinel is returned without errors.Wrap so it has no stack trace`
+}
+
+func sprintf(err error, user string) error {
+	return errs.Wrap(err, fmt.Sprintf("no user %q", user)) // want `fmt.Sprintf in error message, use fudge.KV instead`
+}
+
+func unknown(f func() string) error {
+	return errs.Wrap(nil, fmt.Sprintf("no user %q", f())) // want `fmt.Sprintf in error message, use fudge.KV instead`
+}
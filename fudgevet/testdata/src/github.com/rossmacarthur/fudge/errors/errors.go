@@ -0,0 +1,28 @@
+package errors
+
+import "github.com/rossmacarthur/fudge"
+
+type Error struct {
+	Message string
+	Code    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func Sentinel(msg string, code string) error {
+	return &Error{Message: msg, Code: code}
+}
+
+func New(msg string, opts ...fudge.Option) error {
+	return &Error{Message: msg}
+}
+
+func NewWithCause(msg string, cause error, opts ...fudge.Option) error {
+	return &Error{Message: msg}
+}
+
+func Wrap(err error, msg string, opts ...fudge.Option) error {
+	return err
+}
@@ -0,0 +1,7 @@
+package fudge
+
+type Option interface{}
+
+func KV(k string, x any) Option {
+	return nil
+}
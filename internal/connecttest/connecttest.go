@@ -0,0 +1,173 @@
+package connecttest
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/rossmacarthur/fudge/errors"
+	"github.com/rossmacarthur/fudge/internal/grpctest/pb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	procedureBuy             = "/candystore.CandyStore/Buy"
+	procedureStreamCandyTo   = "/candystore.CandyStore/StreamCandyTo"
+	procedureStreamCandyFrom = "/candystore.CandyStore/StreamCandyFrom"
+)
+
+// ############################################################################
+// Server
+// ############################################################################
+
+var inStock = []string{"chocolate", "gummy", "lollipop"}
+
+type Server struct {
+	client *Client
+	errFn  func() error
+}
+
+func NewServer(url string, opts ...connect.ClientOption) *Server {
+	return &Server{client: NewClient(url, opts...)}
+}
+
+func (s *Server) SetErrFn(fn func() error) {
+	s.errFn = fn
+}
+
+// Handler returns an HTTP handler serving the candy store procedures.
+func (s *Server) Handler(opts ...connect.HandlerOption) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(procedureBuy, connect.NewUnaryHandler(procedureBuy, s.Buy, opts...))
+	mux.Handle(procedureStreamCandyTo, connect.NewClientStreamHandler(procedureStreamCandyTo, s.StreamCandyTo, opts...))
+	mux.Handle(procedureStreamCandyFrom, connect.NewServerStreamHandler(procedureStreamCandyFrom, s.StreamCandyFrom, opts...))
+	return mux
+}
+
+func (s *Server) Buy(ctx context.Context, req *connect.Request[pb.BuyRequest]) (*connect.Response[pb.Candy], error) {
+	if req.Msg.Hops > 0 {
+		err := s.client.Buy(ctx, req.Msg.Hops-1)
+		if err != nil {
+			return nil, err
+		}
+		return connect.NewResponse(&pb.Candy{Name: "chocolate"}), nil
+	}
+
+	err := s.maybeError()
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&pb.Candy{Name: "chocolate"}), nil
+}
+
+func (s *Server) StreamCandyTo(ctx context.Context, stream *connect.ClientStream[pb.Candy]) (*connect.Response[emptypb.Empty], error) {
+	for stream.Receive() {
+		for _, name := range inStock {
+			if name == stream.Msg().Name {
+				return nil, errors.New("already in stock")
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	err := s.maybeError()
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&emptypb.Empty{}), nil
+}
+
+func (s *Server) StreamCandyFrom(ctx context.Context, _ *connect.Request[emptypb.Empty], stream *connect.ServerStream[pb.Candy]) error {
+	for _, name := range inStock {
+		err := stream.Send(&pb.Candy{Name: name})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.maybeError()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) maybeError() error {
+	var err error
+	if s.errFn != nil {
+		err = s.errFn()
+	}
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	return nil
+}
+
+// ############################################################################
+// Client
+// ############################################################################
+
+type Client struct {
+	buy             *connect.Client[pb.BuyRequest, pb.Candy]
+	streamCandyTo   *connect.Client[pb.Candy, emptypb.Empty]
+	streamCandyFrom *connect.Client[emptypb.Empty, pb.Candy]
+}
+
+func NewClient(url string, opts ...connect.ClientOption) *Client {
+	return &Client{
+		buy:             connect.NewClient[pb.BuyRequest, pb.Candy](http.DefaultClient, url+procedureBuy, opts...),
+		streamCandyTo:   connect.NewClient[pb.Candy, emptypb.Empty](http.DefaultClient, url+procedureStreamCandyTo, opts...),
+		streamCandyFrom: connect.NewClient[emptypb.Empty, pb.Candy](http.DefaultClient, url+procedureStreamCandyFrom, opts...),
+	}
+}
+
+func (c *Client) Buy(ctx context.Context, hops int64) error {
+	_, err := c.buy.CallUnary(ctx, connect.NewRequest(&pb.BuyRequest{Hops: hops}))
+	return err
+}
+
+func (c *Client) StreamCandyTo(ctx context.Context, candy []string) error {
+	stream := c.streamCandyTo.CallClientStream(ctx)
+
+	for _, name := range candy {
+		err := stream.Send(&pb.Candy{Name: name})
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	_, err := stream.CloseAndReceive()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) StreamCandyFrom(ctx context.Context) ([]string, error) {
+	stream, err := c.streamCandyFrom.CallServerStream(ctx, connect.NewRequest(&emptypb.Empty{}))
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var candy []string
+
+	for stream.Receive() {
+		candy = append(candy, stream.Msg().Name)
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	return candy, nil
+}
@@ -9,6 +9,7 @@ package fudgepb
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 )
@@ -20,6 +21,55 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type Kind int32
+
+const (
+	Kind_KIND_UNSPECIFIED Kind = 0
+	Kind_KIND_STD         Kind = 1
+	Kind_KIND_FUDGE       Kind = 2
+)
+
+// Enum value maps for Kind.
+var (
+	Kind_name = map[int32]string{
+		0: "KIND_UNSPECIFIED",
+		1: "KIND_STD",
+		2: "KIND_FUDGE",
+	}
+	Kind_value = map[string]int32{
+		"KIND_UNSPECIFIED": 0,
+		"KIND_STD":         1,
+		"KIND_FUDGE":       2,
+	}
+)
+
+func (x Kind) Enum() *Kind {
+	p := new(Kind)
+	*p = x
+	return p
+}
+
+func (x Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_fudge_proto_enumTypes[0].Descriptor()
+}
+
+func (Kind) Type() protoreflect.EnumType {
+	return &file_fudge_proto_enumTypes[0]
+}
+
+func (x Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Kind.Descriptor instead.
+func (Kind) EnumDescriptor() ([]byte, []int) {
+	return file_fudge_proto_rawDescGZIP(), []int{0}
+}
+
 type Error struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -72,11 +122,16 @@ type Hop struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Kind    int32    `protobuf:"varint,1,opt,name=kind,proto3" json:"kind,omitempty"`
-	Binary  string   `protobuf:"bytes,2,opt,name=binary,proto3" json:"binary,omitempty"`
-	Message string   `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
-	Code    string   `protobuf:"bytes,4,opt,name=code,proto3" json:"code,omitempty"`
-	Trace   []*Frame `protobuf:"bytes,5,rep,name=trace,proto3" json:"trace,omitempty"`
+	Kind     Kind                   `protobuf:"varint,1,opt,name=kind,proto3,enum=fudge.Kind" json:"kind,omitempty"`
+	Binary   string                 `protobuf:"bytes,2,opt,name=binary,proto3" json:"binary,omitempty"`
+	Message  string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Code     string                 `protobuf:"bytes,4,opt,name=code,proto3" json:"code,omitempty"`
+	Trace    []*Frame               `protobuf:"bytes,5,rep,name=trace,proto3" json:"trace,omitempty"`
+	Method   string                 `protobuf:"bytes,6,opt,name=method,proto3" json:"method,omitempty"`
+	Peer     string                 `protobuf:"bytes,7,opt,name=peer,proto3" json:"peer,omitempty"`
+	Time     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=time,proto3" json:"time,omitempty"`
+	Version  string                 `protobuf:"bytes,9,opt,name=version,proto3" json:"version,omitempty"`
+	Revision string                 `protobuf:"bytes,10,opt,name=revision,proto3" json:"revision,omitempty"`
 }
 
 func (x *Hop) Reset() {
@@ -111,11 +166,11 @@ func (*Hop) Descriptor() ([]byte, []int) {
 	return file_fudge_proto_rawDescGZIP(), []int{1}
 }
 
-func (x *Hop) GetKind() int32 {
+func (x *Hop) GetKind() Kind {
 	if x != nil {
 		return x.Kind
 	}
-	return 0
+	return Kind_KIND_UNSPECIFIED
 }
 
 func (x *Hop) GetBinary() string {
@@ -146,6 +201,41 @@ func (x *Hop) GetTrace() []*Frame {
 	return nil
 }
 
+func (x *Hop) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *Hop) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *Hop) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Hop) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Hop) GetRevision() string {
+	if x != nil {
+		return x.Revision
+	}
+	return ""
+}
+
 type Frame struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -156,6 +246,10 @@ type Frame struct {
 	Line      int32       `protobuf:"varint,3,opt,name=line,proto3" json:"line,omitempty"`
 	Message   string      `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
 	KeyValues []*KeyValue `protobuf:"bytes,5,rep,name=key_values,json=keyValues,proto3" json:"key_values,omitempty"`
+	Package   string      `protobuf:"bytes,6,opt,name=package,proto3" json:"package,omitempty"`
+	Receiver  string      `protobuf:"bytes,7,opt,name=receiver,proto3" json:"receiver,omitempty"`
+	Pc        uint64      `protobuf:"varint,8,opt,name=pc,proto3" json:"pc,omitempty"`
+	Inlined   bool        `protobuf:"varint,9,opt,name=inlined,proto3" json:"inlined,omitempty"`
 }
 
 func (x *Frame) Reset() {
@@ -225,6 +319,34 @@ func (x *Frame) GetKeyValues() []*KeyValue {
 	return nil
 }
 
+func (x *Frame) GetPackage() string {
+	if x != nil {
+		return x.Package
+	}
+	return ""
+}
+
+func (x *Frame) GetReceiver() string {
+	if x != nil {
+		return x.Receiver
+	}
+	return ""
+}
+
+func (x *Frame) GetPc() uint64 {
+	if x != nil {
+		return x.Pc
+	}
+	return 0
+}
+
+func (x *Frame) GetInlined() bool {
+	if x != nil {
+		return x.Inlined
+	}
+	return false
+}
+
 type KeyValue struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -284,18 +406,30 @@ var File_fudge_proto protoreflect.FileDescriptor
 
 var file_fudge_proto_rawDesc = []byte{
 	0x0a, 0x0b, 0x66, 0x75, 0x64, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x05, 0x66,
-	0x75, 0x64, 0x67, 0x65, 0x22, 0x27, 0x0a, 0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x1e, 0x0a,
-	0x04, 0x68, 0x6f, 0x70, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x66, 0x75,
-	0x64, 0x67, 0x65, 0x2e, 0x48, 0x6f, 0x70, 0x52, 0x04, 0x68, 0x6f, 0x70, 0x73, 0x22, 0x83, 0x01,
-	0x0a, 0x03, 0x48, 0x6f, 0x70, 0x12, 0x12, 0x0a, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x05, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x69, 0x6e,
-	0x61, 0x72, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x69, 0x6e, 0x61, 0x72,
-	0x79, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x63,
-	0x6f, 0x64, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12,
-	0x22, 0x0a, 0x05, 0x74, 0x72, 0x61, 0x63, 0x65, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c,
-	0x2e, 0x66, 0x75, 0x64, 0x67, 0x65, 0x2e, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x52, 0x05, 0x74, 0x72,
-	0x61, 0x63, 0x65, 0x22, 0x95, 0x01, 0x0a, 0x05, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a,
+	0x75, 0x64, 0x67, 0x65, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x27, 0x0a, 0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x1e,
+	0x0a, 0x04, 0x68, 0x6f, 0x70, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x66,
+	0x75, 0x64, 0x67, 0x65, 0x2e, 0x48, 0x6f, 0x70, 0x52, 0x04, 0x68, 0x6f, 0x70, 0x73, 0x22, 0xa2,
+	0x02, 0x0a, 0x03, 0x48, 0x6f, 0x70, 0x12, 0x1f, 0x0a, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x0b, 0x2e, 0x66, 0x75, 0x64, 0x67, 0x65, 0x2e, 0x4b, 0x69, 0x6e,
+	0x64, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x69, 0x6e, 0x61, 0x72,
+	0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x12,
+	0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x22, 0x0a,
+	0x05, 0x74, 0x72, 0x61, 0x63, 0x65, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x66,
+	0x75, 0x64, 0x67, 0x65, 0x2e, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x52, 0x05, 0x74, 0x72, 0x61, 0x63,
+	0x65, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x65, 0x65,
+	0x72, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x65, 0x65, 0x72, 0x12, 0x2e, 0x0a,
+	0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x18, 0x0a,
+	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07,
+	0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x76, 0x69, 0x73,
+	0x69, 0x6f, 0x6e, 0x22, 0xf5, 0x01, 0x0a, 0x05, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a,
 	0x04, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x66, 0x69, 0x6c,
 	0x65, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20,
 	0x01, 0x28, 0x09, 0x52, 0x08, 0x66, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a,
@@ -304,14 +438,24 @@ var file_fudge_proto_rawDesc = []byte{
 	0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2e, 0x0a, 0x0a, 0x6b,
 	0x65, 0x79, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32,
 	0x0f, 0x2e, 0x66, 0x75, 0x64, 0x67, 0x65, 0x2e, 0x4b, 0x65, 0x79, 0x56, 0x61, 0x6c, 0x75, 0x65,
-	0x52, 0x09, 0x6b, 0x65, 0x79, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x22, 0x32, 0x0a, 0x08, 0x4b,
+	0x52, 0x09, 0x6b, 0x65, 0x79, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x70,
+	0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x61,
+	0x63, 0x6b, 0x61, 0x67, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65,
+	0x72, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65,
+	0x72, 0x12, 0x0e, 0x0a, 0x02, 0x70, 0x63, 0x18, 0x08, 0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x70,
+	0x63, 0x12, 0x18, 0x0a, 0x07, 0x69, 0x6e, 0x6c, 0x69, 0x6e, 0x65, 0x64, 0x18, 0x09, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x07, 0x69, 0x6e, 0x6c, 0x69, 0x6e, 0x65, 0x64, 0x22, 0x32, 0x0a, 0x08, 0x4b,
 	0x65, 0x79, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c,
-	0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x42,
-	0x31, 0x5a, 0x2f, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x72, 0x6f,
-	0x73, 0x73, 0x6d, 0x61, 0x63, 0x61, 0x72, 0x74, 0x68, 0x75, 0x72, 0x2f, 0x66, 0x75, 0x64, 0x67,
-	0x65, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x66, 0x75, 0x64, 0x67, 0x65,
-	0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x2a,
+	0x3a, 0x0a, 0x04, 0x4b, 0x69, 0x6e, 0x64, 0x12, 0x14, 0x0a, 0x10, 0x4b, 0x49, 0x4e, 0x44, 0x5f,
+	0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0c, 0x0a,
+	0x08, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x53, 0x54, 0x44, 0x10, 0x01, 0x12, 0x0e, 0x0a, 0x0a, 0x4b,
+	0x49, 0x4e, 0x44, 0x5f, 0x46, 0x55, 0x44, 0x47, 0x45, 0x10, 0x02, 0x42, 0x31, 0x5a, 0x2f, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x72, 0x6f, 0x73, 0x73, 0x6d, 0x61,
+	0x63, 0x61, 0x72, 0x74, 0x68, 0x75, 0x72, 0x2f, 0x66, 0x75, 0x64, 0x67, 0x65, 0x2f, 0x69, 0x6e,
+	0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x66, 0x75, 0x64, 0x67, 0x65, 0x70, 0x62, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -326,22 +470,27 @@ func file_fudge_proto_rawDescGZIP() []byte {
 	return file_fudge_proto_rawDescData
 }
 
+var file_fudge_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
 var file_fudge_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_fudge_proto_goTypes = []interface{}{
-	(*Error)(nil),    // 0: fudge.Error
-	(*Hop)(nil),      // 1: fudge.Hop
-	(*Frame)(nil),    // 2: fudge.Frame
-	(*KeyValue)(nil), // 3: fudge.KeyValue
+	(Kind)(0),                     // 0: fudge.Kind
+	(*Error)(nil),                 // 1: fudge.Error
+	(*Hop)(nil),                   // 2: fudge.Hop
+	(*Frame)(nil),                 // 3: fudge.Frame
+	(*KeyValue)(nil),              // 4: fudge.KeyValue
+	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
 }
 var file_fudge_proto_depIdxs = []int32{
-	1, // 0: fudge.Error.hops:type_name -> fudge.Hop
-	2, // 1: fudge.Hop.trace:type_name -> fudge.Frame
-	3, // 2: fudge.Frame.key_values:type_name -> fudge.KeyValue
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	2, // 0: fudge.Error.hops:type_name -> fudge.Hop
+	0, // 1: fudge.Hop.kind:type_name -> fudge.Kind
+	3, // 2: fudge.Hop.trace:type_name -> fudge.Frame
+	5, // 3: fudge.Hop.time:type_name -> google.protobuf.Timestamp
+	4, // 4: fudge.Frame.key_values:type_name -> fudge.KeyValue
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_fudge_proto_init() }
@@ -404,13 +553,14 @@ func file_fudge_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_fudge_proto_rawDesc,
-			NumEnums:      0,
+			NumEnums:      1,
 			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_fudge_proto_goTypes,
 		DependencyIndexes: file_fudge_proto_depIdxs,
+		EnumInfos:         file_fudge_proto_enumTypes,
 		MessageInfos:      file_fudge_proto_msgTypes,
 	}.Build()
 	File_fudge_proto = out.File
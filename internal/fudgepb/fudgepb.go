@@ -1,100 +1,239 @@
 package fudgepb
 
 import (
-	"context"
-	"sort"
+	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	stderrors "errors"
 
 	"github.com/rossmacarthur/fudge/errors"
 )
 
-const (
-	kindStd   int32 = 1
-	kindFudge int32 = 2
-)
-
-const (
-	codeContextCanceled         = "context.Canceled"
-	codeContextDeadlineExceeded = "context.DeadlineExceeded"
-)
-
+// FromProto converts the protobuf representation back into an error. The data
+// is validated against the default limits, see FromProtoWithLimits.
 func FromProto(pb *Error) error {
+	return FromProtoWithLimits(pb, DefaultLimits)
+}
+
+// FromProtoWithLimits converts the protobuf representation back into an error.
+//
+// The data may come from an untrusted peer so it is validated against the
+// given limits. If the data is invalid or exceeds the limits then a
+// *DecodeError is returned which wraps the readable parts of the data.
+func FromProtoWithLimits(pb *Error, l Limits) error {
 	if pb == nil {
 		return nil
 	}
 
-	var err error
-	var done bool
+	d := &decoder{limits: l}
 
-	for i := len(pb.Hops) - 1; i >= 0; i-- {
-		hop := pb.Hops[i]
-		err, done = errorFromHop(hop, err)
-		if done {
-			break
-		}
+	hops := pb.Hops
+	if l.MaxHops > 0 && len(hops) > l.MaxHops {
+		d.invalid("too many hops")
+		// NB: Keep the innermost hops because they contain the root cause.
+		hops = hops[len(hops)-l.MaxHops:]
 	}
 
+	var err error
+	for i := len(hops) - 1; i >= 0; i-- {
+		err = d.errorFromHop(hops[i], err)
+	}
+
+	if len(d.reasons) > 0 {
+		return &DecodeError{Reasons: d.reasons, Err: err}
+	}
 	return err
 }
 
-func errorFromHop(hop *Hop, cause error) (error, bool) {
+// decoder converts protobuf hops into errors and records the reasons the data
+// is invalid.
+type decoder struct {
+	limits  Limits
+	reasons []string
+}
+
+func (d *decoder) invalid(reason string) {
+	for _, r := range d.reasons {
+		if r == reason {
+			return
+		}
+	}
+	d.reasons = append(d.reasons, reason)
+}
+
+func (d *decoder) errorFromHop(hop *Hop, cause error) error {
+	if hop == nil {
+		d.invalid("nil hop")
+		return cause
+	}
+
 	switch hop.Kind {
 
-	case kindStd:
-		switch hop.Code {
-		case codeContextCanceled:
-			return context.Canceled, true
-		case codeContextDeadlineExceeded:
-			return context.DeadlineExceeded, true
+	case Kind_KIND_STD:
+		msg := d.string(hop.Message)
+		if cause != nil {
+			// NB: A non-Fudge error that wraps the next hop, it only needs
+			// the message since Is and As look through it to the cause.
+			if hop.Code != "" {
+				d.invalid("std hop with a code is not the last hop")
+			}
+			return &wrapError{msg: msg, cause: cause}
 		}
-		return stderrors.New(hop.Message), true
-
-	case kindFudge:
-		hop := errors.Error{
-			Binary:  hop.Binary,
-			Message: hop.Message,
-			Code:    hop.Code,
-			Cause:   cause, // NB: Each error wraps the previous hop
-			Trace:   traceFromProto(hop.Trace),
+		if err, ok := errors.LookupSentinel(hop.Code); ok {
+			if msg == err.Error() {
+				return err
+			}
+			return &sentinelError{msg: msg, sentinel: err}
 		}
-		return &hop, false
+		return stderrors.New(msg)
 
+	case Kind_KIND_FUDGE:
 	default:
-		return errors.New("invalid data"), true
+		// NB: All the fields are still readable so decode it like a Fudge hop.
+		d.invalid(fmt.Sprintf("unknown hop kind %d", hop.Kind))
 	}
+
+	return &errors.Error{
+		Binary:   d.string(hop.Binary),
+		Message:  d.string(hop.Message),
+		Code:     d.string(hop.Code),
+		Cause:    cause, // NB: Each error wraps the previous hop
+		Metadata: d.metadataFromProto(hop),
+		Trace:    d.traceFromProto(hop.Trace),
+	}
+}
+
+// sentinelError is a non-Fudge error decoded from the wire that matches a
+// registered sentinel error but has a different message, e.g. a *fs.PathError
+// that matches fs.ErrNotExist.
+type sentinelError struct {
+	msg      string
+	sentinel error
+}
+
+func (e *sentinelError) Error() string {
+	return e.msg
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.sentinel
 }
 
-func traceFromProto(pb []*Frame) []errors.Frame {
+// wrapError is a non-Fudge error decoded from the wire that wraps another hop,
+// e.g. an error created with fmt.Errorf using %w.
+type wrapError struct {
+	msg   string
+	cause error
+}
+
+func (e *wrapError) Error() string {
+	return e.msg
+}
+
+func (e *wrapError) Unwrap() error {
+	return e.cause
+}
+
+func (d *decoder) traceFromProto(pb []*Frame) []errors.Frame {
+	if d.limits.MaxFrames > 0 && len(pb) > d.limits.MaxFrames {
+		d.invalid("too many frames")
+		pb = pb[:d.limits.MaxFrames]
+	}
+
 	trace := make([]errors.Frame, 0, len(pb))
 	for _, f := range pb {
+		if f == nil {
+			d.invalid("nil frame")
+			continue
+		}
 		trace = append(trace, errors.Frame{
-			File:      f.File,
-			Function:  f.Function,
+			File:      d.string(f.File),
+			Function:  d.string(f.Function),
 			Line:      int(f.Line),
-			Message:   f.Message,
-			KeyValues: keyValuesFromProto(f.KeyValues),
+			Message:   d.string(f.Message),
+			KeyValues: d.keyValuesFromProto(f.KeyValues),
+			Package:   d.string(f.Package),
+			Receiver:  d.string(f.Receiver),
+			PC:        uintptr(f.Pc),
+			Inlined:   f.Inlined,
 		})
 	}
 	return trace
 }
 
-func keyValuesFromProto(pb []*KeyValue) errors.KeyValues {
-	m := make(errors.KeyValues, len(pb))
+func (d *decoder) keyValuesFromProto(pb []*KeyValue) errors.KeyValues {
+	if d.limits.MaxKeyValues > 0 && len(pb) > d.limits.MaxKeyValues {
+		d.invalid("too many key values")
+		pb = pb[:d.limits.MaxKeyValues]
+	}
+
+	if len(pb) == 0 {
+		return nil
+	}
+
+	kvs := make(errors.KeyValues, 0, len(pb))
 	for _, kv := range pb {
-		m[kv.Key] = kv.Value
+		if kv == nil {
+			d.invalid("nil key value")
+			continue
+		}
+		k := d.string(kv.Key)
+		if _, ok := kvs.Get(k); ok {
+			d.invalid("duplicate key")
+			continue
+		}
+		kvs = append(kvs, errors.KeyValue{Key: k, Value: d.string(kv.Value)})
+	}
+	return kvs
+}
+
+// string truncates the string to the maximum length, making sure that the
+// result is still valid UTF-8.
+func (d *decoder) string(s string) string {
+	if d.limits.MaxStringLen > 0 && len(s) > d.limits.MaxStringLen {
+		d.invalid("string too long")
+		s = truncate(s, d.limits.MaxStringLen)
+	}
+	if !utf8.ValidString(s) {
+		d.invalid("invalid UTF-8 string")
+		s = strings.ToValidUTF8(s, "\uFFFD")
 	}
-	return m
+	return s
 }
 
+// truncate returns the longest prefix of the string that is at most n bytes
+// long without splitting a multi-byte character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ToProto converts the error into its protobuf representation. The data is
+// truncated to the default limits so that it can always be decoded using
+// FromProto, e.g. the message of a non-Fudge error that wraps a long chain of
+// errors.
 func ToProto(err error) *Error {
-	var hops []*Hop
+	return ToProtoWithMetadata(err, nil)
+}
+
+// ToProtoWithMetadata is like ToProto but records the given metadata for every
+// hop that doesn't have any yet, i.e. for errors that originated in this
+// process. Errors decoded using FromProto always have metadata.
+func ToProtoWithMetadata(err error, md *errors.Metadata) *Error {
+	e := &encoder{limits: DefaultLimits}
 
+	var hops []*Hop
 	for {
 		if err == nil {
 			break
 		}
-		hop, done := errorToHop(err)
+		hop, done := e.errorToHop(err, md)
 		hops = append(hops, hop)
 		if done {
 			break
@@ -102,68 +241,121 @@ func ToProto(err error) *Error {
 		err = errors.Unwrap(err)
 	}
 
+	if e.limits.MaxHops > 0 && len(hops) > e.limits.MaxHops {
+		// NB: Keep the innermost hops like FromProto does.
+		hops = hops[len(hops)-e.limits.MaxHops:]
+	}
+
 	return &Error{Hops: hops}
 }
 
-func errorToHop(err error) (*Hop, bool) {
+// encoder converts errors into protobuf hops and truncates the data to the
+// limits.
+type encoder struct {
+	limits Limits
+}
+
+func (e *encoder) errorToHop(err error, md *errors.Metadata) (*Hop, bool) {
 	ferr, ok := err.(*errors.Error)
 	if ok {
+		hop := &Hop{
+			Kind:    Kind_KIND_FUDGE,
+			Binary:  e.string(ferr.Binary),
+			Message: e.string(ferr.Message),
+			Code:    e.string(ferr.Code),
+			Trace:   e.traceToProto(ferr.Trace),
+		}
+		if ferr.Metadata != nil {
+			md = ferr.Metadata
+		}
+		e.metadataToProto(md, hop)
+		return hop, false
+	}
+
+	if wrapsFudge(err) {
+		// NB: Look through non-Fudge wrappers, e.g. fmt.Errorf with %w, so
+		// that the inner Fudge errors are kept as hops.
 		return &Hop{
-			Kind:    kindFudge,
-			Binary:  ferr.Binary,
-			Message: ferr.Message,
-			Code:    ferr.Code,
-			Trace:   traceToProto(ferr.Trace),
+			Kind:    Kind_KIND_STD,
+			Message: e.string(err.Error()),
 		}, false
 	}
 
-	// Not a Fudge error, see if it is a supported sentinel
-	var code string
-	if errors.Is(err, context.Canceled) {
-		code = codeContextCanceled
-	} else if errors.Is(err, context.DeadlineExceeded) {
-		code = codeContextDeadlineExceeded
-	}
+	// Not a Fudge error, see if it is a registered sentinel
+	code, _ := errors.SentinelCode(err)
 
 	return &Hop{
-		Kind:    kindStd,
-		Message: err.Error(),
+		Kind:    Kind_KIND_STD,
+		Message: e.string(err.Error()),
 		Code:    code,
 	}, true
 }
 
-func traceToProto(trace []errors.Frame) []*Frame {
+// wrapsFudge reports whether there is a Fudge error in the chain of errors
+// that wrap a single error
+func wrapsFudge(err error) bool {
+	for err = errors.Unwrap(err); err != nil; err = errors.Unwrap(err) {
+		if _, ok := err.(*errors.Error); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *encoder) traceToProto(trace []errors.Frame) []*Frame {
+	if e.limits.MaxFrames > 0 && len(trace) > e.limits.MaxFrames {
+		trace = trace[:e.limits.MaxFrames]
+	}
+
 	pb := make([]*Frame, 0, len(trace))
 	for _, f := range trace {
 		pb = append(pb, &Frame{
-			File:      f.File,
-			Function:  f.Function,
+			File:      e.string(f.File),
+			Function:  e.string(f.Function),
 			Line:      int32(f.Line),
-			Message:   f.Message,
-			KeyValues: keyValuesToProto(f.KeyValues),
+			Message:   e.string(f.Message),
+			KeyValues: e.keyValuesToProto(f.KeyValues),
+			Package:   e.string(f.Package),
+			Receiver:  e.string(f.Receiver),
+			Pc:        uint64(f.PC),
+			Inlined:   f.Inlined,
 		})
 	}
 	return pb
 }
 
-func keyValuesToProto(m errors.KeyValues) []*KeyValue {
-	if len(m) == 0 {
-		return nil
+func (e *encoder) keyValuesToProto(kvs errors.KeyValues) []*KeyValue {
+	if e.limits.MaxKeyValues > 0 && len(kvs) > e.limits.MaxKeyValues {
+		kvs = kvs[:e.limits.MaxKeyValues]
 	}
 
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+	if len(kvs) == 0 {
+		return nil
 	}
-	sort.Strings(keys)
 
-	pb := make([]*KeyValue, 0, len(m))
-	for _, k := range keys {
+	pb := make([]*KeyValue, 0, len(kvs))
+	seen := make(map[string]bool, len(kvs))
+	for _, kv := range kvs {
+		// NB: Truncated keys can collide.
+		k := e.string(kv.Key)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
 		pb = append(pb, &KeyValue{
 			Key:   k,
-			Value: m[k],
+			Value: e.string(kv.Value),
 		})
 	}
 
 	return pb
 }
+
+// string makes the string valid UTF-8 and truncates it to the maximum length.
+func (e *encoder) string(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if e.limits.MaxStringLen > 0 {
+		s = truncate(s, e.limits.MaxStringLen)
+	}
+	return s
+}
@@ -2,14 +2,25 @@ package fudgepb
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	stderrors "errors"
 
 	"github.com/rossmacarthur/fudge"
 	"github.com/rossmacarthur/fudge/errors"
+	_ "github.com/rossmacarthur/fudge/errors/stdsentinels"
 	"github.com/sebdah/goldie/v2"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var errSentinel = errors.Sentinel("such test", "TEST1234")
@@ -24,7 +35,7 @@ func TestFromProto(t *testing.T) {
 			err: &Error{
 				Hops: []*Hop{
 					{
-						Kind:    kindFudge,
+						Kind:    Kind_KIND_FUDGE,
 						Binary:  "fudgepb.test",
 						Message: "such test",
 					},
@@ -36,7 +47,7 @@ func TestFromProto(t *testing.T) {
 			err: &Error{
 				Hops: []*Hop{
 					{
-						Kind:   kindFudge,
+						Kind:   Kind_KIND_FUDGE,
 						Binary: "fudgepb.test",
 						Trace: []*Frame{
 							{
@@ -60,12 +71,41 @@ func TestFromProto(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "one fudge hop with metadata",
+			err: &Error{
+				Hops: []*Hop{
+					{
+						Kind:     Kind_KIND_FUDGE,
+						Binary:   "fudgepb.test",
+						Method:   "/candystore.CandyStore/Buy",
+						Peer:     "127.0.0.1:1337",
+						Time:     timestamppb.New(time.Date(2023, 5, 22, 13, 37, 0, 0, time.UTC)),
+						Version:  "v1.2.3",
+						Revision: "0a6834a",
+						Trace: []*Frame{
+							{
+								File:     "github.com/rossmacarthur/fudge/internal/fudgepb/fudgepb_test.go",
+								Function: "TestFromProto",
+								Line:     24,
+								Message:  "such test",
+							},
+							{
+								File:     "runtime/asm_arch.s",
+								Function: "goexit",
+								Line:     1337,
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "two fudge hops",
 			err: &Error{
 				Hops: []*Hop{
 					{
-						Kind:   kindFudge,
+						Kind:   Kind_KIND_FUDGE,
 						Binary: "fudgepb.test",
 						Trace: []*Frame{
 							{
@@ -87,7 +127,7 @@ func TestFromProto(t *testing.T) {
 						},
 					},
 					{
-						Kind:   kindFudge,
+						Kind:   Kind_KIND_FUDGE,
 						Binary: "fudgepb.test",
 						Trace: []*Frame{
 							{
@@ -122,9 +162,9 @@ func TestFromProto(t *testing.T) {
 			err: &Error{
 				Hops: []*Hop{
 					{
-						Kind:    kindStd,
+						Kind:    Kind_KIND_STD,
 						Message: "context canceled",
-						Code:    codeContextCanceled,
+						Code:    "context.Canceled",
 					},
 				},
 			},
@@ -134,7 +174,7 @@ func TestFromProto(t *testing.T) {
 			err: &Error{
 				Hops: []*Hop{
 					{
-						Kind:   kindFudge,
+						Kind:   Kind_KIND_FUDGE,
 						Binary: "fudgepb.test",
 						Trace: []*Frame{
 							{
@@ -157,9 +197,9 @@ func TestFromProto(t *testing.T) {
 					},
 
 					{
-						Kind:    kindStd,
+						Kind:    Kind_KIND_STD,
 						Message: "context canceled",
-						Code:    codeContextCanceled,
+						Code:    "context.Canceled",
 					},
 				},
 			},
@@ -237,6 +277,13 @@ func TestToProto(t *testing.T) {
 				return err
 			},
 		},
+		{
+			name: "foreign wrapper",
+			errFn: func() error {
+				err := errors.Wrap(errSentinel, "very wrap", fudge.KV("foo", "bar"))
+				return errors.Wrap(fmt.Errorf("such context: %w", err), "")
+			},
+		},
 	}
 
 	g := goldie.New(t, goldie.WithTestNameForDir(true))
@@ -245,6 +292,9 @@ func TestToProto(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			got := ToProto(tt.errFn())
 			for _, hop := range got.Hops {
+				for _, f := range hop.Trace {
+					f.Pc = 0 // NB: The program counters depend on the build
+				}
 				if len(hop.Trace) > 0 {
 					hop.Trace[len(hop.Trace)-1] = dummyFrame
 				}
@@ -271,4 +321,291 @@ func TestRoundtrip(t *testing.T) {
 	require.False(t, errors.Is(got, context.DeadlineExceeded))
 	require.False(t, errors.Is(got, err))
 	require.False(t, errors.Is(got, errSentinel))
+
+	err = errors.New("such test", fudge.KV("foo", "bar"), fudge.KV("baz", "qux"))
+	got = FromProto(ToProto(err))
+	var ferr *errors.Error
+	require.True(t, errors.As(got, &ferr))
+	require.Equal(t, errors.KeyValues{{Key: "foo", Value: "bar"}, {Key: "baz", Value: "qux"}}, ferr.Trace[0].KeyValues)
+	require.Equal(t, err.(*errors.Error).Trace, ferr.Trace)
+	require.Equal(t, "github.com/rossmacarthur/fudge/internal/fudgepb", ferr.Trace[0].Package)
+
+	// NB: Deep stack traces are truncated to fit the default limits.
+	var deep func(int) error
+	deep = func(n int) error {
+		if n == 0 {
+			return errors.New("such test")
+		}
+		return deep(n - 1)
+	}
+	got = FromProto(ToProto(deep(1000)))
+	derr := new(DecodeError)
+	require.False(t, errors.As(got, &derr))
+}
+
+func TestRoundtripForeign(t *testing.T) {
+	inner := errors.Wrap(errSentinel, "very wrap", fudge.KV("foo", "bar"))
+	err := errors.Wrap(fmt.Errorf("such context: %w", inner), "")
+
+	pb := ToProto(err)
+	require.Len(t, pb.Hops, 3)
+	require.Equal(t, Kind_KIND_STD, pb.Hops[1].Kind)
+	require.Equal(t, "such context: very wrap: such test (TEST1234)", pb.Hops[1].Message)
+
+	got := FromProto(pb)
+	require.Equal(t, err.Error(), got.Error())
+	require.True(t, errors.Is(got, errSentinel))
+
+	var ferr *errors.Error
+	require.True(t, errors.As(errors.Unwrap(errors.Unwrap(got)), &ferr))
+	require.Equal(t, errors.KeyValues{{Key: "foo", Value: "bar"}}, ferr.Trace[0].KeyValues)
+
+	// NB: The wrapper message includes the wrapped messages so it is truncated
+	// to fit the default limits.
+	long := fmt.Errorf("such context: %w", errors.New(strings.Repeat("a", 5000)))
+	pb = ToProto(long)
+	require.Len(t, pb.Hops[0].Message, DefaultLimits.MaxStringLen)
+	got = FromProto(ToProto(FromProto(pb)))
+	derr := new(DecodeError)
+	require.False(t, errors.As(got, &derr))
+}
+
+var errDriver = stderrors.New("driver: bad connection")
+
+func init() {
+	errors.RegisterSentinel("fudgepb.errDriver", errDriver)
+}
+
+func TestRoundtripSentinels(t *testing.T) {
+	_, errOpen := os.Open("does-not-exist")
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{name: "io.EOF", err: io.EOF, target: io.EOF},
+		{name: "os.ErrNotExist", err: os.ErrNotExist, target: os.ErrNotExist},
+		{name: "fs.ErrPermission", err: fs.ErrPermission, target: fs.ErrPermission},
+		{name: "sql.ErrNoRows", err: sql.ErrNoRows, target: sql.ErrNoRows},
+		{name: "path error", err: errOpen, target: fs.ErrNotExist},
+		{name: "registered", err: errDriver, target: errDriver},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := errors.Wrap(tt.err, "very wrap")
+			got := FromProto(ToProto(err))
+			require.True(t, errors.Is(got, tt.target))
+			require.False(t, errors.Is(got, context.Canceled))
+			require.Equal(t, err.Error(), got.Error())
+		})
+	}
+}
+
+func TestRoundtripMetadata(t *testing.T) {
+	md := &errors.Metadata{
+		Method:   "/candystore.CandyStore/Buy",
+		Peer:     "127.0.0.1:1337",
+		Time:     time.Date(2023, 5, 22, 13, 37, 0, 0, time.UTC),
+		Version:  "v1.2.3",
+		Revision: "0a6834a",
+	}
+
+	// errors from this process get the metadata
+	err := errors.Wrap(errSentinel, "very wrap")
+	got := FromProto(ToProtoWithMetadata(err, md))
+	ferr := new(errors.Error)
+	require.True(t, errors.As(got, &ferr))
+	require.Equal(t, md, ferr.Metadata)
+
+	// decoded errors keep their own metadata
+	other := &errors.Metadata{Method: "/candystore.CandyStore/Other"}
+	err = errors.NewWithCause("rpc error", got)
+	got = FromProto(ToProtoWithMetadata(err, other))
+	require.True(t, errors.As(got, &ferr))
+	require.Equal(t, other, ferr.Metadata)
+	require.True(t, errors.As(ferr.Cause, &ferr))
+	require.Equal(t, md, ferr.Metadata)
+}
+
+func TestFromProtoWithLimits(t *testing.T) {
+	limits := Limits{MaxHops: 2, MaxFrames: 1, MaxKeyValues: 1, MaxStringLen: 9}
+
+	hop := func(kind Kind, msg string) *Hop {
+		return &Hop{
+			Kind:    kind,
+			Message: msg,
+			Trace: []*Frame{
+				{
+					File:      "main.go",
+					Function:  "main",
+					Line:      1,
+					KeyValues: []*KeyValue{{Key: "a", Value: "b"}, {Key: "c", Value: "d"}},
+				},
+				{
+					File:     "runtime/proc.go",
+					Function: "main",
+					Line:     250,
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		err  *Error
+		exp  string
+	}{
+		{
+			name: "valid",
+			err:  &Error{Hops: []*Hop{{Kind: Kind_KIND_FUDGE, Message: "such test"}}},
+			exp:  "such test",
+		},
+		{
+			name: "unknown kind",
+			err:  &Error{Hops: []*Hop{{Kind: 7, Message: "such test"}}},
+			exp:  "invalid error data (unknown hop kind 7): such test",
+		},
+		{
+			name: "std hop not last",
+			err: &Error{Hops: []*Hop{
+				{Kind: Kind_KIND_STD, Message: "ctx: test"},
+				{Kind: Kind_KIND_FUDGE, Message: "test"},
+			}},
+			exp: "ctx: test",
+		},
+		{
+			name: "std hop with code not last",
+			err: &Error{Hops: []*Hop{
+				{Kind: Kind_KIND_STD, Message: "EOF", Code: "io.EOF"},
+				{Kind: Kind_KIND_FUDGE, Message: "such test"},
+			}},
+			exp: "invalid error data (std hop with a code is not the last hop): EOF",
+		},
+		{
+			name: "too many hops",
+			err: &Error{Hops: []*Hop{
+				{Kind: Kind_KIND_FUDGE, Message: "one"},
+				{Kind: Kind_KIND_FUDGE, Message: "two"},
+				{Kind: Kind_KIND_FUDGE, Message: "three"},
+			}},
+			exp: "invalid error data (too many hops): two: three",
+		},
+		{
+			name: "too many frames and key values",
+			err:  &Error{Hops: []*Hop{hop(Kind_KIND_FUDGE, "such test")}},
+			exp:  "invalid error data (too many frames, too many key values): such test",
+		},
+		{
+			name: "string too long",
+			err:  &Error{Hops: []*Hop{{Kind: Kind_KIND_FUDGE, Message: "such a long test"}}},
+			exp:  "invalid error data (string too long): such a lo",
+		},
+		{
+			name: "string too long within rune",
+			err:  &Error{Hops: []*Hop{{Kind: Kind_KIND_FUDGE, Message: "such a lé test"}}},
+			exp:  "invalid error data (string too long): such a l",
+		},
+		{
+			name: "invalid utf-8",
+			err:  &Error{Hops: []*Hop{{Kind: Kind_KIND_FUDGE, Message: "such\xfftest"}}},
+			exp:  "invalid error data (invalid UTF-8 string): such\uFFFDtest",
+		},
+		{
+			name: "nil hop",
+			err:  &Error{Hops: []*Hop{nil, {Kind: Kind_KIND_FUDGE, Message: "such test"}}},
+			exp:  "invalid error data (nil hop): such test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FromProtoWithLimits(tt.err, limits)
+			require.Equal(t, tt.exp, err.Error())
+		})
+	}
+
+	err := FromProtoWithLimits(&Error{Hops: []*Hop{
+		hop(Kind_KIND_FUDGE, "such test"),
+		{Kind: Kind_KIND_STD, Message: "EOF", Code: "io.EOF"},
+	}}, limits)
+	require.True(t, errors.Is(err, io.EOF))
+	derr := new(DecodeError)
+	require.True(t, errors.As(err, &derr))
+	require.Equal(t, []string{"too many frames", "too many key values"}, derr.Reasons)
+
+	err = FromProto(&Error{Hops: []*Hop{{
+		Kind:    Kind_KIND_FUDGE,
+		Message: "such test",
+		Trace:   []*Frame{{KeyValues: []*KeyValue{{Key: "a", Value: "b"}, {Key: "a", Value: "c"}}}},
+	}}})
+	require.Equal(t, "invalid error data (duplicate key): such test", err.Error())
+}
+
+func FuzzFromProto(f *testing.F) {
+	for _, err := range []error{
+		io.EOF,
+		errors.New("such test", fudge.KV("foo", "bar")),
+		errors.Wrap(errSentinel, "very wrap", fudge.KV("foo", "bar")),
+		errors.NewWithCause("rpc error", errors.Wrap(context.Canceled, "very wrap")),
+		errors.Wrap(fmt.Errorf("such context: %w", errors.New("such test")), ""),
+	} {
+		b, err := proto.Marshal(ToProto(err))
+		require.Nil(f, err)
+		f.Add(b)
+	}
+
+	// A wrapper hop stores the whole message, including the messages of the
+	// hops it wraps, so it can exceed the limits once decoded and re-encoded.
+	b, err := proto.Marshal(&Error{Hops: []*Hop{
+		{Kind: Kind_KIND_STD, Message: strings.Repeat("a", 5000)},
+		{Kind: Kind_KIND_FUDGE, Message: strings.Repeat("b", 5000)},
+	}})
+	require.Nil(f, err)
+	f.Add(b)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		pb := new(Error)
+		if proto.Unmarshal(b, pb) != nil {
+			return
+		}
+
+		err := FromProto(pb)
+		if err == nil {
+			require.Empty(t, pb.Hops)
+			return
+		}
+		_ = fmt.Sprintf("%#v", err)
+
+		// Decoding the encoded error again should always be valid
+		got := FromProto(ToProto(err))
+		require.NotNil(t, got)
+		require.False(t, errors.As(got, new(*DecodeError)))
+	})
+}
+
+func FuzzRoundtrip(f *testing.F) {
+	f.Add("such test", "very wrap", "TEST1234", "foo", "bar")
+	f.Add("", "", "", "", "")
+
+	f.Fuzz(func(t *testing.T, msg, wrap, code, k, v string) {
+		for _, s := range []string{msg, wrap, code, k, v} {
+			if !utf8.ValidString(s) || len(s) > DefaultLimits.MaxStringLen {
+				return
+			}
+		}
+
+		err := errors.Wrap(errors.Sentinel(msg, code), wrap, fudge.KV(k, v))
+		pb := ToProto(err)
+
+		b, merr := proto.Marshal(pb)
+		require.Nil(t, merr)
+		pb = new(Error)
+		require.Nil(t, proto.Unmarshal(b, pb))
+
+		got := FromProto(pb)
+		require.Equal(t, err.Error(), got.Error())
+		require.Equal(t, errors.Is(got, err), code != "")
+	})
 }
@@ -0,0 +1,48 @@
+package fudgepb
+
+import (
+	"strings"
+)
+
+// Limits bounds the size of the data accepted by FromProtoWithLimits. A zero
+// value for any of the fields means there is no limit.
+type Limits struct {
+	// MaxHops is the maximum number of hops
+	MaxHops int
+	// MaxFrames is the maximum number of frames per hop
+	MaxFrames int
+	// MaxKeyValues is the maximum number of key values per frame
+	MaxKeyValues int
+	// MaxStringLen is the maximum length in bytes of any string
+	MaxStringLen int
+}
+
+// DefaultLimits are the limits used by FromProto.
+var DefaultLimits = Limits{
+	MaxHops:      32,
+	MaxFrames:    512,
+	MaxKeyValues: 64,
+	MaxStringLen: 4096,
+}
+
+// DecodeError is returned when the protobuf representation of an error is
+// invalid or exceeds the limits.
+type DecodeError struct {
+	// Reasons describes why the data is invalid
+	Reasons []string
+	// Err is the readable part of the data (can be nil)
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	msg := "invalid error data (" + strings.Join(e.Reasons, ", ") + ")"
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the readable part of the data
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,78 @@
+package fudgepb
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rossmacarthur/fudge/errors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	buildOnce     sync.Once
+	buildVersion  string
+	buildRevision string
+)
+
+// buildInfo returns the main module version and VCS revision of the running
+// binary, if available.
+func buildInfo() (version, revision string) {
+	buildOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		buildVersion = info.Main.Version
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				buildRevision = s.Value
+			}
+		}
+	})
+	return buildVersion, buildRevision
+}
+
+// NewMetadata returns the hop metadata for an error returned by the given RPC
+// method called by the given peer. The build information is read from the
+// running binary.
+func NewMetadata(method, peer string) *errors.Metadata {
+	version, revision := buildInfo()
+	return &errors.Metadata{
+		Method:   method,
+		Peer:     peer,
+		Time:     time.Now(),
+		Version:  version,
+		Revision: revision,
+	}
+}
+
+func (d *decoder) metadataFromProto(hop *Hop) *errors.Metadata {
+	md := &errors.Metadata{
+		Method:   d.string(hop.Method),
+		Peer:     d.string(hop.Peer),
+		Version:  d.string(hop.Version),
+		Revision: d.string(hop.Revision),
+	}
+	if hop.Time != nil {
+		if err := hop.Time.CheckValid(); err != nil {
+			d.invalid("invalid time")
+		} else {
+			md.Time = hop.Time.AsTime()
+		}
+	}
+	return md
+}
+
+func (e *encoder) metadataToProto(md *errors.Metadata, hop *Hop) {
+	if md == nil {
+		return
+	}
+	hop.Method = e.string(md.Method)
+	hop.Peer = e.string(md.Peer)
+	if !md.Time.IsZero() {
+		hop.Time = timestamppb.New(md.Time)
+	}
+	hop.Version = e.string(md.Version)
+	hop.Revision = e.string(md.Revision)
+}
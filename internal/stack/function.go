@@ -0,0 +1,122 @@
+package stack
+
+import (
+	"strings"
+	"unicode"
+)
+
+// function is a runtime function name split into its parts
+type function struct {
+	// pkg is the import path of the package
+	pkg string
+	// receiver is the receiver type of the method (can be empty)
+	receiver string
+	// name is the function name without the package
+	name string
+}
+
+// splitFunction splits the runtime function name and cleans it up: closures
+// are named after their parents, e.g. func2.1 becomes func2.func1. The elided
+// type arguments of generic functions are kept, e.g. Map[...].
+func splitFunction(name string) function {
+	i := strings.LastIndex(name, pathSep) + 1
+	j := strings.Index(name[i:], pkgSep)
+	if j == -1 {
+		return function{name: name}
+	}
+
+	fn := function{pkg: unescape(name[:i+j])}
+	if fn.pkg == "main" {
+		if p := mainPackage(); p != "" {
+			fn.pkg = p
+		}
+	}
+
+	elems := splitElems(name[i+j+len(pkgSep):])
+
+	var clean []string
+	for k, e := range elems {
+		switch {
+		case k == 0 && e == "glob" && len(elems) > 2 && elems[1] == "":
+			// NB: Closures of package variables before Go 1.22, e.g.
+			// glob..func1, are named like they are since, e.g. init.func1.
+			clean = append(clean, "init")
+		case e == "" && k == 1 && elems[0] == "glob":
+		case isDigits(e) && k > 0 && isClosure(elems[k-1]):
+			clean = append(clean, "func"+e)
+		default:
+			clean = append(clean, e)
+		}
+	}
+	fn.name = strings.Join(clean, pkgSep)
+
+	if hasReceiver(elems) {
+		fn.receiver = strings.TrimSuffix(strings.TrimPrefix(elems[0], "("), ")")
+	}
+
+	return fn
+}
+
+// RuntimeName reverses the clean up of the function name by splitFunction so
+// that closures are named like the runtime names them, e.g. func2.func1
+// becomes func2.1. Closures of package variables from before Go 1.22 are not
+// restored.
+func RuntimeName(name string) string {
+	elems := splitElems(name)
+	raw := make([]string, len(elems))
+	for k, e := range elems {
+		raw[k] = e
+		// NB: The only digits left in a clean name are the indexes of init
+		// functions, e.g. init.0.func1, which are not closures.
+		if rest, ok := strings.CutPrefix(e, "func"); ok && isDigits(rest) && k > 0 &&
+			isClosure(elems[k-1]) && !isDigits(elems[k-1]) {
+			raw[k] = rest
+		}
+	}
+	return strings.Join(raw, pkgSep)
+}
+
+// splitElems splits the function name at the dots outside of brackets, e.g.
+// the type arguments of generic functions
+func splitElems(name string) []string {
+	var elems []string
+	var depth, start int
+	for i, r := range name {
+		switch r {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case '.':
+			if depth == 0 {
+				elems = append(elems, name[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(elems, name[start:])
+}
+
+// isClosure reports whether the element of a function name is a closure, e.g.
+// func1, gowrap1, deferwrap1 or 1
+func isClosure(elem string) bool {
+	for _, prefix := range []string{"func", "gowrap", "deferwrap"} {
+		if rest, ok := strings.CutPrefix(elem, prefix); ok && isDigits(rest) {
+			return true
+		}
+	}
+	return isDigits(elem)
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) == -1
+}
+
+// hasReceiver reports whether the first element of the function name is the
+// receiver type of a method, e.g. (*Server) or Plain in Plain.Sell.func1
+func hasReceiver(elems []string) bool {
+	if strings.HasPrefix(elems[0], "(") {
+		return true
+	}
+	return len(elems) > 1 && !isClosure(elems[1]) && elems[0] != "init" && elems[0] != "glob"
+}
@@ -1,8 +1,13 @@
 package stack
 
 import (
+	"fmt"
+	"net/url"
+	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"strings"
+	"sync"
 )
 
 // Frame is a simplified version of runtime.Frame
@@ -10,68 +15,322 @@ type Frame struct {
 	File     string
 	Function string
 	Line     int
+	Package  string
+	Receiver string
+	PC       uintptr
+	// Inlined is true if the function was inlined into its caller, the PC is
+	// then within the caller
+	Inlined bool
 }
 
-// Trace returns a stack trace, skipping the given number of frames
+// newFrame returns the simplified frame and records its source information
+func newFrame(frame runtime.Frame) Frame {
+	fn := splitFunction(frame.Function)
+	return Frame{
+		File:     record(frame.Function, frame.File),
+		Function: fn.name,
+		Line:     frame.Line,
+		Package:  fn.pkg,
+		Receiver: fn.receiver,
+		PC:       frame.PC,
+		// NB: Func is also nil for non-Go code which has no function name.
+		Inlined: frame.Func == nil && frame.Function != "",
+	}
+}
+
+const (
+	// MaxFrames is the maximum number of frames in a stack trace including
+	// the frame that marks the elided frames, see Trace
+	MaxFrames = 512
+	// tailFrames is the number of outermost frames kept when a stack trace
+	// is truncated
+	tailFrames = MaxFrames / 4
+	// maxCallers is the maximum number of program counters captured, deeper
+	// stacks are truncated without keeping the outermost frames
+	maxCallers = 1 << 16
+)
+
+// Trace returns a stack trace, skipping the given number of frames.
+//
+// Stacks with more than MaxFrames frames are truncated like runtime
+// tracebacks: the innermost and outermost frames are kept with a frame in
+// between that has no file and a function like "...42 frames elided...". If
+// the stack is too deep to find the outermost frames then only the innermost
+// frames are kept followed by "...additional frames elided...".
 func Trace(skip int) []Frame {
-	var pcs [512]uintptr
-	n := runtime.Callers(skip+1, pcs[:])
-	frames := runtime.CallersFrames(pcs[:n])
-	trace := make([]Frame, 0, n)
-	frame, more := frames.Next()
-	for more {
-		frame, more = frames.Next()
-		trace = append(trace, Frame{
-			File:     tidyFile(frame.Function, frame.File),
-			Function: tidyFunction(frame.Function),
-			Line:     frame.Line,
-		})
+	pcs, complete := callers(skip + 1)
+	if len(pcs) == 0 {
+		return nil
+	}
+
+	// NB: A program counter can expand to multiple frames if functions were
+	// inlined into it so the frames are counted after expanding.
+	var all []runtime.Frame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		all = append(all, frame)
+		if !more {
+			break
+		}
+	}
+
+	if len(all) <= MaxFrames && complete {
+		trace := make([]Frame, 0, len(all))
+		for _, f := range all {
+			trace = append(trace, newFrame(f))
+		}
+		return trace
+	}
+
+	head, tail := MaxFrames-1, 0
+	if complete {
+		head, tail = MaxFrames-tailFrames-1, tailFrames
+	}
+	trace := make([]Frame, 0, MaxFrames)
+	for _, f := range all[:head] {
+		trace = append(trace, newFrame(f))
+	}
+	if complete {
+		trace = append(trace, Frame{Function: fmt.Sprintf("...%d frames elided...", len(all)-head-tail)})
+	} else {
+		trace = append(trace, Frame{Function: "...additional frames elided..."})
+	}
+	for _, f := range all[len(all)-tail:] {
+		trace = append(trace, newFrame(f))
 	}
 	return trace
 }
 
-// Call returns the frame of the caller, skipping the given number of frames
+// Call returns the frame of the caller, skipping the given number of frames.
+// It is the same as the first frame returned by Trace.
 func Call(skip int) Frame {
-	var pcs [3]uintptr
-	n := runtime.Callers(skip+1, pcs[:])
-	frames := runtime.CallersFrames(pcs[:n])
-	frame, _ := frames.Next()
-	frame, _ = frames.Next()
-	return Frame{
-		File:     tidyFile(frame.Function, frame.File),
-		Function: tidyFunction(frame.Function),
-		Line:     frame.Line,
+	// NB: The program counters are skipped the same way as Trace, a few are
+	// captured since the caller may have been inlined.
+	var pcs [8]uintptr
+	n := runtime.Callers(skip+2, pcs[:])
+	frame, _ := runtime.CallersFrames(pcs[:n]).Next()
+	return newFrame(frame)
+}
+
+// callers returns the program counters of the stack skipping the given number
+// of frames, where zero is the caller of callers. It returns false if the
+// stack is deeper than maxCallers and was truncated.
+func callers(skip int) ([]uintptr, bool) {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(skip+2, pcs)
+		if n < len(pcs) {
+			return pcs[:n], true
+		}
+		if len(pcs) >= maxCallers {
+			return pcs, false
+		}
+		pcs = make([]uintptr, 2*len(pcs))
 	}
 }
 
-const pathSep = "/"
-const pkgSep = "."
+// Source is the source information of a tidied file name
+type Source struct {
+	// Path is the absolute path of the file (can be empty)
+	Path string
+	// Package is the package path of the file
+	Package string
+	// Std is true if the package is in the standard library
+	Std bool
+}
 
-func tidyFunction(function string) string {
-	if i := strings.LastIndex(function, pathSep); i != -1 {
-		function = function[i+len(pathSep):]
+// sources maps tidied file names to the source information of the frames
+// captured by this process
+var sources sync.Map
+
+// record stores the source information of the tidied file name and returns
+// the tidied file name
+func record(function, file string) string {
+	tidy := tidyFile(function, file)
+	if _, ok := sources.Load(tidy); !ok {
+		src := Source{Package: packagePath(function), Std: isStd(function, file)}
+		if filepath.IsAbs(file) {
+			src.Path = file
+		}
+		sources.Store(tidy, src)
 	}
-	if i := strings.Index(function, pkgSep); i != -1 {
-		function = function[i+len(pkgSep):]
+	return tidy
+}
+
+// packagePath returns the package path of the function
+func packagePath(function string) string {
+	i := strings.LastIndex(function, pathSep) + 1
+	if j := strings.Index(function[i:], pkgSep); j != -1 {
+		return function[:i+j]
 	}
 	return function
 }
 
+// isStd reports whether the function is in the standard library, i.e. the file
+// is in GOROOT. If GOROOT or the absolute path of the file is not known then
+// the first element of the package path not containing a dot is used instead,
+// which is wrong for module paths without a dot, e.g. mycompany/svc.
+func isStd(function, file string) bool {
+	if root := goroot(); root != "" && filepath.IsAbs(file) {
+		return strings.HasPrefix(filepath.ToSlash(file), root+"/src/")
+	}
+	if i := strings.Index(function, pathSep); i != -1 {
+		return !strings.Contains(function[:i], pkgSep)
+	}
+	// NB: The package path is a single element, e.g. "runtime.main".
+	pkg, _, _ := strings.Cut(function, pkgSep)
+	return pkg != "main"
+}
+
+// Lookup returns the source information of a tidied file name. It is only
+// known for frames captured by this process and the path is not known when
+// built with -trimpath.
+func Lookup(file string) (Source, bool) {
+	src, ok := sources.Load(file)
+	if !ok {
+		return Source{}, false
+	}
+	return src.(Source), true
+}
+
+const pathSep = "/"
+const pkgSep = "."
+
+// PathStyle determines how the file names of frames are rendered
+type PathStyle int
+
+const (
+	// ModulePaths renders the import path of the package followed by the base
+	// name of the file, e.g. github.com/acme/yak/shave/razor.go
+	ModulePaths PathStyle = iota
+	// AbsolutePaths renders the absolute path of the file on the machine that
+	// built the binary, module paths are used if it is not known
+	AbsolutePaths
+	// GOROOTPaths renders files in the standard library relative to GOROOT,
+	// e.g. $GOROOT/src/runtime/proc.go, other files use module paths
+	GOROOTPaths
+)
+
+// Rewrite replaces the prefix of a rendered file name
+type Rewrite struct {
+	Prefix      string
+	Replacement string
+}
+
+// paths is the process-wide configuration used to render file names
+var paths = struct {
+	sync.RWMutex
+	style    PathStyle
+	rewrites []Rewrite
+}{}
+
+// SetPaths sets the style and the prefix rewrites used to render the file
+// names of frames captured after it is called. The first rewrite with a
+// matching prefix is applied.
+func SetPaths(style PathStyle, rewrites []Rewrite) {
+	paths.Lock()
+	defer paths.Unlock()
+
+	paths.style = style
+	paths.rewrites = append([]Rewrite(nil), rewrites...)
+}
+
 func tidyFile(function, file string) string {
-	var pre, post string
+	paths.RLock()
+	defer paths.RUnlock()
 
-	i := strings.LastIndex(file, pathSep)
-	if i == -1 {
-		post = file
-	} else {
-		post = file[strings.LastIndex(file[:i], pathSep)+1:]
+	var tidy string
+	switch {
+	case paths.style == AbsolutePaths && filepath.IsAbs(file):
+		tidy = filepath.ToSlash(file)
+	case paths.style == GOROOTPaths && isStd(function, file):
+		tidy = "$GOROOT/src/" + modulePath(function, file)
+	default:
+		tidy = modulePath(function, file)
 	}
 
-	i = strings.LastIndex(function, pathSep)
-	if i == -1 {
-		return post
+	for _, r := range paths.rewrites {
+		if rest, ok := strings.CutPrefix(tidy, r.Prefix); ok {
+			return r.Replacement + rest
+		}
 	}
-	pre = function[:i]
+	return tidy
+}
 
-	return pre + pathSep + post
+// modulePath returns the import path of the package of the function followed
+// by the base name of the file.
+//
+// The directory of the file is not used because it differs from the import
+// path for major version suffixes, the module cache and vendored code, and it
+// is not known for generated code.
+func modulePath(function, file string) string {
+	if strings.HasPrefix(file, "<") {
+		// NB: Compiler generated code, e.g. <autogenerated>.
+		return file
+	}
+
+	dir, base := "", file
+	if i := strings.LastIndex(file, pathSep); i != -1 {
+		dir, base = file[:i], file[i+len(pathSep):]
+	}
+
+	pkg := unescape(packagePath(function))
+	switch {
+	case pkg == "" || pkg == function:
+		return base
+	case pkg == "main":
+		// NB: The functions of the main package are not qualified by its
+		// import path, except in test binaries.
+		if p := mainPackage(); p != "" {
+			pkg = p
+		} else if dir != "" {
+			return dir[strings.LastIndex(dir, pathSep)+1:] + pathSep + base
+		}
+	case strings.HasSuffix(pkg, "_test") && !strings.HasSuffix(dir, pathSep+pkg[strings.LastIndex(pkg, pathSep)+1:]):
+		// NB: An external test package is in the directory of the package it
+		// tests.
+		pkg = strings.TrimSuffix(pkg, "_test")
+	}
+	return pkg + pathSep + base
 }
+
+// unescape reverses the escaping of package paths in symbol names, e.g. the
+// dots in the last element of gopkg.in/yaml%2ev3
+func unescape(pkg string) string {
+	if !strings.Contains(pkg, "%") {
+		return pkg
+	}
+	if s, err := url.PathUnescape(pkg); err == nil {
+		return s
+	}
+	return pkg
+}
+
+// goroot returns the GOROOT that the binary was built with, derived from the
+// file of runtime.Callers. It is empty if not known, e.g. when built with
+// -trimpath.
+var goroot = sync.OnceValue(func() string {
+	pc := make([]uintptr, 1)
+	if runtime.Callers(0, pc) == 0 {
+		return ""
+	}
+	frame, _ := runtime.CallersFrames(pc).Next()
+	if !filepath.IsAbs(frame.File) {
+		return ""
+	}
+	root, ok := strings.CutSuffix(filepath.ToSlash(filepath.Dir(frame.File)), "/src/runtime")
+	if !ok {
+		return ""
+	}
+	return root
+})
+
+// mainPackage returns the import path of the main package if it is known
+var mainPackage = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Path == "command-line-arguments" || strings.HasSuffix(info.Path, ".test") {
+		return ""
+	}
+	return info.Path
+})
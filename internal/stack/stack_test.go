@@ -0,0 +1,335 @@
+package stack
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModulePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		function string
+		file     string
+		exp      string
+	}{
+		{
+			name:     "package",
+			function: "github.com/acme/yak/shave.(*Razor).Shave",
+			file:     "/home/acme/src/yak/shave/razor.go",
+			exp:      "github.com/acme/yak/shave/razor.go",
+		},
+		{
+			name:     "package name differs from directory",
+			function: "github.com/acme/yak/v2.Shave",
+			file:     "/home/acme/src/yak/shave.go",
+			exp:      "github.com/acme/yak/v2/shave.go",
+		},
+		{
+			name:     "module cache",
+			function: "gopkg.in/yaml%2ev3.(*decoder).unmarshal",
+			file:     "/home/acme/go/pkg/mod/gopkg.in/yaml.v3@v3.0.1/decode.go",
+			exp:      "gopkg.in/yaml.v3/decode.go",
+		},
+		{
+			name:     "vendored",
+			function: "github.com/acme/razor.Sharpen",
+			file:     "/home/acme/src/yak/vendor/github.com/acme/razor/sharpen.go",
+			exp:      "github.com/acme/razor/sharpen.go",
+		},
+		{
+			name:     "generated",
+			function: "github.com/acme/yak/shave._Cfunc_lather",
+			file:     "/tmp/go-build123/b001/_cgo_gotypes.go",
+			exp:      "github.com/acme/yak/shave/_cgo_gotypes.go",
+		},
+		{
+			name:     "external test package",
+			function: "github.com/acme/yak/shave_test.TestShave.func1",
+			file:     "/home/acme/src/yak/shave/shave_test.go",
+			exp:      "github.com/acme/yak/shave/shave_test.go",
+		},
+		{
+			name:     "main without build info",
+			function: "main.main",
+			file:     "/home/acme/src/yak/cmd/shave/main.go",
+			exp:      "shave/main.go",
+		},
+		{
+			name:     "std",
+			function: "runtime.goexit",
+			file:     "/usr/local/go/src/runtime/asm_amd64.s",
+			exp:      "runtime/asm_amd64.s",
+		},
+		{
+			name:     "autogenerated",
+			function: "github.com/acme/yak/shave.(*Razor).String",
+			file:     "<autogenerated>",
+			exp:      "<autogenerated>",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.exp, modulePath(tc.function, tc.file))
+		})
+	}
+}
+
+func TestSetPaths(t *testing.T) {
+	t.Cleanup(func() { SetPaths(ModulePaths, nil) })
+
+	const function = "github.com/acme/yak/shave.Shave"
+	const file = "/home/acme/src/yak/shave/shave.go"
+	std := goroot() + "/src/runtime/proc.go"
+
+	SetPaths(AbsolutePaths, nil)
+	require.Equal(t, file, tidyFile(function, file))
+	require.Equal(t, "github.com/acme/yak/shave/shave.go", tidyFile(function, "github.com/acme/yak/shave/shave.go"))
+
+	SetPaths(GOROOTPaths, nil)
+	require.Equal(t, "github.com/acme/yak/shave/shave.go", tidyFile(function, file))
+	require.Equal(t, "$GOROOT/src/runtime/proc.go", tidyFile("runtime.main", std))
+
+	SetPaths(ModulePaths, []Rewrite{
+		{Prefix: "github.com/acme/", Replacement: "monorepo/"},
+		{Prefix: "github.com/", Replacement: "unused/"},
+	})
+	require.Equal(t, "monorepo/yak/shave/shave.go", tidyFile(function, file))
+	require.Equal(t, "runtime/proc.go", tidyFile("runtime.main", std))
+}
+
+func TestIsStd(t *testing.T) {
+	require.NotEmpty(t, goroot())
+
+	require.True(t, isStd("runtime.main", goroot()+"/src/runtime/proc.go"))
+	require.False(t, isStd("github.com/acme/yak/shave.Shave", "/home/acme/src/yak/shave/shave.go"))
+
+	// module paths without a dot are only known from the file
+	require.False(t, isStd("mycompany/svc.Handle", "/home/acme/src/svc/handle.go"))
+	require.True(t, isStd("mycompany/svc.Handle", "mycompany/svc/handle.go"))
+}
+
+func TestSplitFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		function string
+		exp      function
+	}{
+		{
+			name:     "function",
+			function: "github.com/acme/yak/shave.Shave",
+			exp:      function{pkg: "github.com/acme/yak/shave", name: "Shave"},
+		},
+		{
+			name:     "pointer method",
+			function: "github.com/acme/yak/shave.(*Server).Buy",
+			exp:      function{pkg: "github.com/acme/yak/shave", receiver: "*Server", name: "(*Server).Buy"},
+		},
+		{
+			name:     "value method closure",
+			function: "github.com/acme/yak/shave.Plain.Sell.func1.func2",
+			exp:      function{pkg: "github.com/acme/yak/shave", receiver: "Plain", name: "Plain.Sell.func1.func2"},
+		},
+		{
+			name:     "generic",
+			function: "github.com/acme/yak/shave.(*Server[...]).Buy",
+			exp:      function{pkg: "github.com/acme/yak/shave", receiver: "*Server[...]", name: "(*Server[...]).Buy"},
+		},
+		{
+			name:     "nested deferred closure",
+			function: "github.com/acme/yak/shave.Shave.func2.1",
+			exp:      function{pkg: "github.com/acme/yak/shave", name: "Shave.func2.func1"},
+		},
+		{
+			name:     "init closure",
+			function: "github.com/acme/yak/shave.init.0.func1",
+			exp:      function{pkg: "github.com/acme/yak/shave", name: "init.0.func1"},
+		},
+		{
+			name:     "package variable closure",
+			function: "github.com/acme/yak/shave.glob..func1",
+			exp:      function{pkg: "github.com/acme/yak/shave", name: "init.func1"},
+		},
+		{
+			name:     "escaped package",
+			function: "gopkg.in/yaml%2ev3.(*decoder).unmarshal",
+			exp:      function{pkg: "gopkg.in/yaml.v3", receiver: "*decoder", name: "(*decoder).unmarshal"},
+		},
+		{
+			name:     "std",
+			function: "runtime.goexit",
+			exp:      function{pkg: "runtime", name: "goexit"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.exp, splitFunction(tc.function))
+		})
+	}
+}
+
+func TestRuntimeName(t *testing.T) {
+	for _, function := range []string{
+		"Shave",
+		"(*Server[...]).Buy",
+		"Plain.Sell.func1.2",
+		"Plain.Sell.func1.2.3",
+		"Shave.func2.1.gowrap1",
+		"init.0.func1",
+	} {
+		t.Run(function, func(t *testing.T) {
+			require.Equal(t, function, RuntimeName(splitFunction("github.com/acme/yak/shave."+function).name))
+		})
+	}
+}
+
+type server[T any] struct{}
+
+func (s *server[T]) call() Frame {
+	return Call(0)
+}
+
+func mapCall[K comparable, V any](K, V) Frame {
+	return func() Frame { return Call(0) }()
+}
+
+func TestCallGeneric(t *testing.T) {
+	f := (&server[int]{}).call()
+	require.Equal(t, "(*server[...]).call", f.Function)
+	require.Equal(t, "*server[...]", f.Receiver)
+	require.Equal(t, "github.com/rossmacarthur/fudge/internal/stack", f.Package)
+	require.NotZero(t, f.PC)
+
+	f = mapCall("a", 1)
+	require.Equal(t, "mapCall[...].func1", f.Function)
+	require.Empty(t, f.Receiver)
+}
+
+func recurse(depth int, fn func() []Frame) []Frame {
+	if depth == 0 {
+		return fn()
+	}
+	return recurse(depth-1, fn)
+}
+
+func TestTraceDeep(t *testing.T) {
+	elided := regexp.MustCompile(`^\.\.\.(\d+) frames elided\.\.\.$`)
+	capture := func() []Frame { return Trace(0) }
+
+	trace := recurse(100, capture)
+	require.Equal(t, "TestTraceDeep.func1", trace[0].Function)
+	var n int
+	for _, f := range trace {
+		require.NotRegexp(t, elided, f.Function)
+		if f.Function == "recurse" {
+			n++
+		}
+	}
+	require.Equal(t, 101, n)
+
+	trace = recurse(1000, capture)
+	require.Len(t, trace, MaxFrames)
+	require.Equal(t, "TestTraceDeep.func1", trace[0].Function)
+	marker := trace[MaxFrames-tailFrames-1]
+	require.Empty(t, marker.File)
+	m := elided.FindStringSubmatch(marker.Function)
+	require.NotNil(t, m)
+	n, err := strconv.Atoi(m[1])
+	require.NoError(t, err)
+	// NB: 1001 recurse frames, the closure, the test function, tRunner and
+	// goexit.
+	require.Equal(t, 1001+4-(MaxFrames-1), n)
+	require.Equal(t, "goexit", trace[len(trace)-1].Function)
+	require.Equal(t, "TestTraceDeep", trace[len(trace)-3].Function)
+
+	trace = recurse(maxCallers, capture)
+	require.Len(t, trace, MaxFrames)
+	require.Equal(t, "...additional frames elided...", trace[len(trace)-1].Function)
+	require.Equal(t, "recurse", trace[len(trace)-2].Function)
+}
+
+// capture returns the frame of the caller and the stack trace, skipping the
+// given number of frames
+//
+//go:noinline
+func capture(skip int) (Frame, []Frame) {
+	return Call(skip + 1), Trace(skip + 1)
+}
+
+// inlinable is small enough to be inlined into its caller unless inlining is
+// disabled
+func inlinable(skip int) (Frame, []Frame) {
+	return capture(skip)
+}
+
+//go:noinline
+func notInlinable(skip int) (Frame, []Frame) {
+	return capture(skip)
+}
+
+func TestCallTrace(t *testing.T) {
+	inlining := os.Getenv("STACK_TEST_INLINING")
+
+	check := func(t *testing.T, function string, inlined bool, c Frame, trace []Frame) {
+		require.Equal(t, function, c.Function)
+		require.Equal(t, "TestCallTrace", trace[1].Function)
+		require.False(t, trace[1].Inlined)
+		if inlining != "" {
+			require.Equal(t, inlined, c.Inlined)
+		}
+
+		// NB: Call and Trace agree on the caller, only the program counters
+		// differ since they are different calls.
+		c.PC, trace[0].PC = 0, 0
+		require.Equal(t, c, trace[0])
+	}
+
+	// NB: The functions are called directly since calls through function
+	// values are never inlined.
+	c, trace := notInlinable(0)
+	check(t, "notInlinable", false, c, trace)
+	c, trace = inlinable(0)
+	check(t, "inlinable", inlining == "on", c, trace)
+
+	c, trace = notInlinable(1)
+	require.Equal(t, "TestCallTrace", c.Function)
+	c.PC, trace[0].PC = 0, 0
+	require.Equal(t, c, trace[0])
+	c, trace = inlinable(1)
+	require.Equal(t, "TestCallTrace", c.Function)
+	c.PC, trace[0].PC = 0, 0
+	require.Equal(t, c, trace[0])
+}
+
+// TestInlining runs TestCallTrace with inlining forced on and off since
+// whether a function is inlined depends on the compiler flags.
+func TestInlining(t *testing.T) {
+	if testing.Short() || os.Getenv("STACK_TEST_INLINING") != "" {
+		t.Skip()
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	for _, tc := range []struct {
+		inlining string
+		gcflags  string
+	}{
+		{inlining: "on", gcflags: ""},
+		{inlining: "off", gcflags: "-l"},
+	} {
+		t.Run(tc.inlining, func(t *testing.T) {
+			cmd := exec.Command(gobin, "test", "-count=1", "-run=^TestCallTrace$", "-gcflags="+tc.gcflags, ".")
+			cmd.Env = append(os.Environ(), "STACK_TEST_INLINING="+tc.inlining)
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+		})
+	}
+}
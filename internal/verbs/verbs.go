@@ -0,0 +1,55 @@
+// Package verbs parses the formatting directives in fmt format strings. It is
+// shared by the fudge command and the fudgevet analyzer so that they convert
+// formatted messages in the same way.
+package verbs
+
+import "strings"
+
+// Verb is a formatting directive in a format string.
+type Verb struct {
+	// Start and End are the offsets of the directive in the format string
+	Start, End int
+	// Verb is the verb character, e.g. 'v'
+	Verb byte
+}
+
+// Parse returns the formatting directives in the format string. Formats with
+// explicit argument indexes or star widths are not supported.
+func Parse(format string) ([]Verb, bool) {
+	var vs []Verb
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		start := i
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0123456789.", format[i]) >= 0 {
+			i++
+		}
+		if i >= len(format) {
+			return nil, false
+		}
+		switch format[i] {
+		case '%':
+			continue
+		case '[', '*':
+			return nil, false
+		}
+		vs = append(vs, Verb{Start: start, End: i + 1, Verb: format[i]})
+	}
+	return vs, true
+}
+
+// Message returns the format string with the directives removed and the
+// whitespace and trailing separators tidied up, e.g. "no user %s for id=%d"
+// becomes "no user for id".
+func Message(format string, vs []Verb) string {
+	var b strings.Builder
+	prev := 0
+	for _, v := range vs {
+		b.WriteString(format[prev:v.Start])
+		prev = v.End
+	}
+	b.WriteString(format[prev:])
+	return strings.TrimRight(strings.Join(strings.Fields(b.String()), " "), " :=,")
+}
@@ -0,0 +1,35 @@
+package verbs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	vs, ok := Parse("no user %q for id=%-4d: %w 100%%")
+	require.True(t, ok)
+	require.Equal(t, []Verb{
+		{Start: 8, End: 10, Verb: 'q'},
+		{Start: 18, End: 22, Verb: 'd'},
+		{Start: 24, End: 26, Verb: 'w'},
+	}, vs)
+
+	for _, format := range []string{"%[1]s", "%*d", "trailing %"} {
+		_, ok := Parse(format)
+		require.False(t, ok, format)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	for format, exp := range map[string]string{
+		"failed to shave yak":         "failed to shave yak",
+		"no user %s for id=%d":        "no user for id",
+		"failed to shave yak %d: %w":  "failed to shave yak",
+		"  yak   %v\tnot found, %s  ": "yak not found",
+	} {
+		vs, ok := Parse(format)
+		require.True(t, ok)
+		require.Equal(t, exp, Message(format, vs), format)
+	}
+}